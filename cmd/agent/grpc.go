@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	pb "ypMetrics/internal/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	transportHTTP = "http"
+	transportGRPC = "grpc"
+)
+
+// UseGRPC переключает агента на отправку метрик через gRPC на serverAddress.
+func (a *MetricsAgent) UseGRPC() error {
+	conn, err := grpc.NewClient(a.serverAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+	a.grpcConn = conn
+	a.grpcClient = pb.NewMetricsClient(conn)
+	return nil
+}
+
+func (a *MetricsAgent) sendMetricsGRPC() {
+	batch := a.buildBatch()
+	if len(batch) == 0 {
+		return
+	}
+
+	req := &pb.UpdateMetricsRequest{Metrics: make([]*pb.Metric, 0, len(batch))}
+	for _, m := range batch {
+		req.Metrics = append(req.Metrics, pb.FromModel(m))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.reportInterval)
+	defer cancel()
+
+	if a.key != "" {
+		hash, err := pb.SignMessage(req, a.key)
+		if err != nil {
+			log.Printf("Error signing metrics batch: %v", err)
+			return
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, pb.HashMetadataKey, hash)
+	}
+
+	if _, err := a.grpcClient.UpdateMetrics(ctx, req); err != nil {
+		log.Printf("Error sending metrics batch over gRPC: %v", err)
+	}
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"runtime"
+	"strings"
 	"time"
 	"github.com/spf13/viper"
 	"os"
@@ -15,6 +22,10 @@ import (
 	"syscall"
 	"github.com/asaskevich/govalidator"
 	"ypMetrics/internal/helper"
+	pb "ypMetrics/internal/proto"
+	"ypMetrics/models"
+
+	"google.golang.org/grpc"
 )
 
 type MetricsAgent struct {
@@ -22,6 +33,10 @@ type MetricsAgent struct {
 	pollInterval   time.Duration
 	reportInterval time.Duration
 	metrics        map[string]interface{}
+	key            string
+	labels         models.Labels
+	grpcConn       *grpc.ClientConn
+	grpcClient     pb.MetricsClient
 }
 
 func NewMetricsAgent(serverAddress string, pollInterval, reportInterval time.Duration) *MetricsAgent {
@@ -96,13 +111,131 @@ func (a *MetricsAgent) startReporting() {
 }
 
 func (a *MetricsAgent) sendMetrics() {
+	if a.grpcClient != nil {
+		a.sendMetricsGRPC()
+		return
+	}
+
+	batch := a.buildBatch()
+	if len(batch) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(batch)
+	if err != nil {
+		log.Printf("Error serializing metrics batch: %v", err)
+		return
+	}
+
+	compressed, err := compressBody(body)
+	if err != nil {
+		log.Printf("Error compressing metrics batch: %v", err)
+		return
+	}
+
+	url := fmt.Sprintf("http://%s/updates/", a.serverAddress)
+	req, err := http.NewRequest(http.MethodPost, url, compressed)
+	if err != nil {
+		log.Printf("Error creating request: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Accept-Encoding", "gzip")
+	if a.key != "" {
+		req.Header.Set(helper.HashHeader, helper.ComputeHash(helper.SignedData(req.Method, req.URL.RequestURI(), body), a.key))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("Error sending metrics batch: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if err := a.verifyResponse(resp); err != nil {
+		log.Printf("Error verifying server response: %v", err)
+	}
+
+	// старый сервер без /updates/ — шлём по одной
+	if resp.StatusCode == http.StatusNotFound {
+		a.sendMetricsOneByOne()
+	}
+}
+
+func (a *MetricsAgent) verifyResponse(resp *http.Response) error {
+	if a.key == "" {
+		return nil
+	}
+	// без заголовка проверка обходилась бы простым его удалением
+	hash := resp.Header.Get(helper.HashHeader)
+	if hash == "" {
+		return errors.New("response is not signed")
+	}
+
+	var reader io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if !helper.CheckHash(body, a.key, hash) {
+		return errors.New("response signature mismatch")
+	}
+	return nil
+}
+
+func compressBody(body []byte) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(body); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+func (a *MetricsAgent) buildBatch() []models.Metrics {
+	batch := make([]models.Metrics, 0, len(a.metrics))
+	for name, value := range a.metrics {
+		switch v := value.(type) {
+		case float64:
+			batch = append(batch, models.Metrics{ID: name, MType: models.Gauge, Value: &v, Labels: a.labels})
+		case int64:
+			batch = append(batch, models.Metrics{ID: name, MType: models.Counter, Delta: &v, Labels: a.labels})
+		}
+	}
+	return batch
+}
+
+func (a *MetricsAgent) sendMetricsOneByOne() {
 	for name, value := range a.metrics {
 		url := a.formatMetricURL(name, value)
 		if url == "" {
 			continue // Пропускаем неподдерживаемые типы
 		}
 
-		resp, err := http.Post(url, "text/plain", nil)
+		req, err := http.NewRequest(http.MethodPost, url, nil)
+		if err != nil {
+			log.Printf("Error creating request for metric %s: %v", name, err)
+			continue
+		}
+		req.Header.Set("Content-Type", "text/plain")
+		if a.key != "" {
+			req.Header.Set(helper.HashHeader, helper.ComputeHash(helper.SignedData(req.Method, req.URL.RequestURI(), nil), a.key))
+		}
+
+		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			log.Printf("Error sending metric %s: %v", name, err)
 			continue
@@ -112,20 +245,51 @@ func (a *MetricsAgent) sendMetrics() {
 }
 
 func (a *MetricsAgent) formatMetricURL(metricName string, value interface{}) string {
+	var u string
 	switch v := value.(type) {
 	case float64:
-		return fmt.Sprintf("http://%s/update/gauge/%s/%f", a.serverAddress, metricName, v)
+		u = fmt.Sprintf("http://%s/update/gauge/%s/%f", a.serverAddress, metricName, v)
 	case int64:
-		return fmt.Sprintf("http://%s/update/counter/%s/%d", a.serverAddress, metricName, v)
+		u = fmt.Sprintf("http://%s/update/counter/%s/%d", a.serverAddress, metricName, v)
 	default:
 		return ""
 	}
+	if len(a.labels) > 0 {
+		query := url.Values{}
+		for k, v := range a.labels {
+			query.Set(k, v)
+		}
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// parseLabels разбирает метки агента из строки вида "host=a,region=eu".
+func parseLabels(s string) (models.Labels, error) {
+	if s == "" {
+		return nil, nil
+	}
+	labels := make(models.Labels)
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: '%s' is not key=value", models.ErrInvalidLabel, pair)
+		}
+		labels[k] = v
+	}
+	if err := labels.Validate(); err != nil {
+		return nil, err
+	}
+	return labels, nil
 }
 
 var (
 	serverAddress  string
 	reportInterval int
 	pollInterval   int
+	key            string
+	transport      string
+	labels         string
 )
 
 func main() {
@@ -140,20 +304,36 @@ func main() {
     envAddress := viper.GetString("ADDRESS") 
 	envReportInterval := viper.GetInt("REPORT_INTERVAL") 
 	envPollInterval := viper.GetInt("POLL_INTERVAL") 
+	envKey := viper.GetString("KEY")
+	envTransport := viper.GetString("TRANSPORT")
+	envLabels := viper.GetString("LABELS")
 
 	flag.StringVar(&serverAddress, "a", "localhost:8080", "server adress")
 	flag.IntVar(&reportInterval, "r", 10, "report interval")
 	flag.IntVar(&pollInterval, "p", 2, "poll interval")
+	flag.StringVar(&key, "k", "", "key for HMAC-SHA256 signing")
+	flag.StringVar(&transport, "t", transportHTTP, "transport: http or grpc")
+	flag.StringVar(&labels, "l", "", "labels for all metrics, e.g. host=a,region=eu")
 
 	flag.Parse()
 
 	helper.AssignIfNotEmpty(&serverAddress, envAddress)
 	helper.AssignIfNotEmpty(&reportInterval, envReportInterval)
 	helper.AssignIfNotEmpty(&pollInterval, envPollInterval)
+	helper.AssignIfNotEmpty(&key, envKey)
+	helper.AssignIfNotEmpty(&transport, envTransport)
+	helper.AssignIfNotEmpty(&labels, envLabels)
 
 	if !govalidator.IsURL(serverAddress) {
     	log.Fatalf("некорректный URL %s",serverAddress)
 	}
+	if transport != transportHTTP && transport != transportGRPC {
+		log.Fatalf("неизвестный транспорт %s", transport)
+	}
+	agentLabels, err := parseLabels(labels)
+	if err != nil {
+		log.Fatalf("некорректные метки %s: %v", labels, err)
+	}
 
 	go func() {
 		fmt.Printf("start push metric to %s", serverAddress)
@@ -163,6 +343,16 @@ func main() {
 			time.Duration(pollInterval)*time.Second,
 			time.Duration(reportInterval)*time.Second,
 		)
+		agent.key = key
+		agent.labels = agentLabels
+		if transport == transportGRPC {
+			if err := agent.UseGRPC(); err != nil {
+				log.Printf("Error: %v", err)
+				cancel()
+				return
+			}
+			defer agent.grpcConn.Close()
+		}
 		agent.Run()
 		<-ctx.Done()
 	}()
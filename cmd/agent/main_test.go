@@ -1,13 +1,23 @@
 package main
 
 import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 	"os"
 	"flag"
+	"strings"
+	"context"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"ypMetrics/internal/helper"
+	"ypMetrics/internal/metrics"
+	"ypMetrics/internal/services"
+	"ypMetrics/models"
 )
 
 func TestNewMetricsAgent(t *testing.T) {
@@ -90,6 +100,206 @@ func TestSendMetrics(t *testing.T) {
 	agent.sendMetrics()
 }
 
+func TestSendMetricsBatch(t *testing.T) {
+	var received []models.Metrics
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/updates/", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		gz, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, json.NewDecoder(gz).Decode(&received))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	agent := NewMetricsAgent(ts.URL[7:], 1*time.Second, 1*time.Second)
+	agent.metrics["TestGauge"] = 3.14
+	agent.metrics["TestCounter"] = int64(42)
+	agent.metrics["TestInvalid"] = "string"
+
+	agent.sendMetrics()
+
+	assert.Len(t, received, 2)
+	for _, m := range received {
+		switch m.ID {
+		case "TestGauge":
+			assert.Equal(t, models.Gauge, m.MType)
+			assert.Equal(t, 3.14, *m.Value)
+		case "TestCounter":
+			assert.Equal(t, models.Counter, m.MType)
+			assert.Equal(t, int64(42), *m.Delta)
+		default:
+			t.Errorf("unexpected metric %s", m.ID)
+		}
+	}
+}
+
+func TestSendMetricsLabels(t *testing.T) {
+	var received []models.Metrics
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, json.NewDecoder(gz).Decode(&received))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	agent := NewMetricsAgent(ts.URL[7:], 1*time.Second, 1*time.Second)
+	agent.labels = models.Labels{"host": "a"}
+	agent.metrics["TestGauge"] = 3.14
+
+	agent.sendMetrics()
+
+	if assert.Len(t, received, 1) {
+		assert.Equal(t, models.Labels{"host": "a"}, received[0].Labels)
+	}
+	assert.Equal(t, "http://"+ts.URL[7:]+"/update/gauge/TestGauge/3.140000?host=a", agent.formatMetricURL("TestGauge", 3.14))
+}
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    models.Labels
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "host=a", want: models.Labels{"host": "a"}},
+		{in: "host=a, region=eu", want: models.Labels{"host": "a", "region": "eu"}},
+		{in: "host", wantErr: true},
+		{in: "host=", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseLabels(tt.in)
+		if tt.wantErr {
+			assert.Error(t, err, tt.in)
+			continue
+		}
+		assert.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+}
+
+func TestSendMetricsSigned(t *testing.T) {
+	const key = "secret"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		body, err := io.ReadAll(gz)
+		assert.NoError(t, err)
+		assert.True(t, helper.CheckHash(body, key, r.Header.Get(helper.HashHeader)), "body must be signed")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	agent := NewMetricsAgent(ts.URL[7:], 1*time.Second, 1*time.Second)
+	agent.key = key
+	agent.metrics["TestGauge"] = 3.14
+
+	agent.sendMetrics()
+}
+
+func TestVerifyResponse(t *testing.T) {
+	const key = "secret"
+	response := func(body, hash string) *http.Response {
+		resp := &http.Response{Header: make(http.Header), Body: io.NopCloser(strings.NewReader(body))}
+		if hash != "" {
+			resp.Header.Set(helper.HashHeader, hash)
+		}
+		return resp
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		resp    *http.Response
+		wantErr bool
+	}{
+		{name: "signed", key: key, resp: response("ok", helper.ComputeHash([]byte("ok"), key))},
+		{name: "wrong signature", key: key, resp: response("ok", helper.ComputeHash([]byte("ok"), "other")), wantErr: true},
+		{name: "missing signature", key: key, resp: response("ok", ""), wantErr: true},
+		{name: "no key", resp: response("ok", "")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := NewMetricsAgent("localhost:8080", time.Second, time.Second)
+			agent.key = tt.key
+			err := agent.verifyResponse(tt.resp)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestSendMetricsFallback(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/updates/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	agent := NewMetricsAgent(ts.URL[7:], 1*time.Second, 1*time.Second)
+	agent.metrics["TestCounter"] = int64(42)
+
+	agent.sendMetrics()
+
+	assert.Equal(t, []string{"/updates/", "/update/counter/TestCounter/42"}, paths)
+}
+
+func TestSendMetricsFallbackSigned(t *testing.T) {
+	const key = "secret"
+	var signed []bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/updates/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		data := helper.SignedData(r.Method, r.RequestURI, nil)
+		signed = append(signed, helper.CheckHash(data, key, r.Header.Get(helper.HashHeader)))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	agent := NewMetricsAgent(ts.URL[7:], 1*time.Second, 1*time.Second)
+	agent.key = key
+	agent.labels = models.Labels{"host": "a"}
+	agent.metrics["TestCounter"] = int64(42)
+
+	agent.sendMetrics()
+
+	assert.Equal(t, []bool{true}, signed, "url updates must be signed with method and uri")
+}
+
+func TestSendMetricsGRPC(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storage := metrics.NewMemStorage()
+	addr, err := services.ListenGRPC(ctx, "127.0.0.1:0", storage, "secret")
+	require.NoError(t, err)
+
+	agent := NewMetricsAgent(addr.String(), 1*time.Second, 1*time.Second)
+	agent.key = "secret"
+	require.NoError(t, agent.UseGRPC())
+	defer agent.grpcConn.Close()
+	agent.metrics["TestGauge"] = 3.14
+	agent.metrics["TestCounter"] = int64(42)
+
+	agent.sendMetrics()
+
+	all, err := storage.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3.14, all.Gauges["TestGauge"])
+	assert.Equal(t, int64(42), all.Counters["TestCounter"])
+}
+
 func TestAgentRun(t *testing.T) {
 	agent := NewMetricsAgent("localhost:8080", 100*time.Millisecond, 100*time.Millisecond)
 	agent.Run()
@@ -1,28 +1,64 @@
 package main
 
 import (
+	"context"
+	"io"
+	"log"
+	"os/signal"
+	"syscall"
 	"ypMetrics/internal/metrics"
+	"ypMetrics/internal/misc"
 	"ypMetrics/internal/services"
 	"ypMetrics/internal/store"
 	"os"
 	"fmt"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
 )
 
 func main() {
-	storage :=  initStorage()
-	err:=services.NewMetricServer(storage)
+	cfg := misc.LoadServerConfig()
+
+	storage, err := initStorage(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	storage = store.NewStreamStorage(storage)
+	if cfg.HistoryRetention > 0 {
+		storage = store.NewHistoryStorage(storage, cfg.HistoryRetention)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err = services.NewMetricServer(ctx, cfg, storage)
+
+	if closer, ok := storage.(io.Closer); ok {
+		if closeErr := closer.Close(); closeErr != nil {
+			log.Printf("Error closing storage: %v", closeErr)
+		}
+	}
+
 	if err != nil{
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
         os.Exit(1)
 	}
 }
 
-func initStorage() store.Storage {
+func initStorage(cfg misc.ServerConfig) (store.Storage, error) {
 	//refactored after added some storage
     switch os.Getenv("STORAGE_TYPE") {
     case "memory":
-        return metrics.NewMemStorage()
+        return metrics.NewMemStorage(), nil
     default:
-        return metrics.NewMemStorage()
+        if cfg.DatabaseDSN != "" {
+            return store.NewSQLStorage(store.DriverFromDSN(cfg.DatabaseDSN))
+        }
+        if cfg.FileStoragePath == "" {
+            return metrics.NewMemStorage(), nil
+        }
+        return store.NewFileStorage(metrics.NewMemStorage(), cfg.FileStoragePath, cfg.StoreInterval, cfg.Restore)
     }
-}
\ No newline at end of file
+}
@@ -0,0 +1,233 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+)
+
+// State — состояние правила.
+type State string
+
+const (
+	// StateInactive — условие не выполняется
+	StateInactive State = "inactive"
+	// StatePending — условие выполняется, но меньше For
+	StatePending State = "pending"
+	// StateFiring — условие выполняется не меньше For
+	StateFiring State = "firing"
+	// StateResolved — алерт сработал, а потом условие перестало выполняться
+	StateResolved State = "resolved"
+)
+
+// Alert — текущее состояние одного правила.
+type Alert struct {
+	Name       string        `json:"name"`
+	Expr       string        `json:"expr"`
+	Metric     string        `json:"metric"`
+	Labels     models.Labels `json:"labels,omitempty"`
+	State      State         `json:"state"`
+	Value      float64       `json:"value"`
+	ActiveAt   *time.Time    `json:"activeAt,omitempty"`
+	FiredAt    *time.Time    `json:"firedAt,omitempty"`
+	ResolvedAt *time.Time    `json:"resolvedAt,omitempty"`
+}
+
+// Engine раз в interval проверяет правила по хранилищу и ведёт их состояния.
+type Engine struct {
+	storage store.Storage
+	now     func() time.Time
+
+	// evaluating не даёт проверкам идти параллельно и охраняет prev и prevAt
+	evaluating sync.Mutex
+
+	// mu охраняет список правил и состояния алертов, но не чтение хранилища
+	mu       sync.RWMutex
+	rules    []*ruleState
+	onChange func([]Alert)
+}
+
+type ruleState struct {
+	rule  Rule
+	alert Alert
+
+	// для rate: предыдущее значение счётчика и время его чтения
+	prev   float64
+	prevAt time.Time
+}
+
+func NewEngine(storage store.Storage, rules []Rule) *Engine {
+	e := &Engine{
+		storage: storage,
+		now:     time.Now,
+		rules:   make([]*ruleState, 0, len(rules)),
+	}
+	for _, rule := range rules {
+		e.rules = append(e.rules, &ruleState{
+			rule: rule,
+			alert: Alert{
+				Name:   rule.Name,
+				Expr:   rule.Expr,
+				Metric: rule.Metric,
+				Labels: rule.Labels,
+				State:  StateInactive,
+			},
+		})
+	}
+	return e
+}
+
+// Run проверяет правила сразу и затем раз в interval, пока не отменён ctx.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		e.Evaluate(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// OnChange задаёт функцию, которой после каждой проверки передаются
+// алерты, перешедшие в firing или resolved. Вызывать до Run.
+func (e *Engine) OnChange(fn func([]Alert)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onChange = fn
+}
+
+// Evaluate один раз проверяет все правила. Если метрику не удалось
+// прочитать, состояние её правила не меняется до следующей проверки.
+// Хранилище читается без e.mu: медленная база не должна держать GET /alerts.
+func (e *Engine) Evaluate(ctx context.Context) {
+	e.evaluating.Lock()
+	defer e.evaluating.Unlock()
+
+	e.mu.RLock()
+	rules := slices.Clone(e.rules)
+	e.mu.RUnlock()
+
+	type result struct {
+		rs     *ruleState
+		active bool
+		value  float64
+	}
+	now := e.now()
+	results := make([]result, 0, len(rules))
+	for _, rs := range rules {
+		value, ok, err := e.value(ctx, rs, now)
+		if err != nil {
+			log.Printf("Error evaluating alert rule %s: %v", rs.rule.Name, err)
+			continue
+		}
+		results = append(results, result{rs: rs, active: ok && rs.rule.Match(value), value: value})
+	}
+
+	e.mu.Lock()
+	var changed []Alert
+	for _, r := range results {
+		if r.rs.transition(r.active, r.value, now) {
+			changed = append(changed, r.rs.alert)
+		}
+	}
+	onChange := e.onChange
+	e.mu.Unlock()
+
+	if onChange != nil && len(changed) > 0 {
+		onChange(changed)
+	}
+}
+
+// Alerts возвращает все правила, кроме неактивных, по имени.
+func (e *Engine) Alerts() []Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	alerts := make([]Alert, 0)
+	for _, rs := range e.rules {
+		if rs.alert.State != StateInactive {
+			alerts = append(alerts, rs.alert)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Name < alerts[j].Name
+	})
+	return alerts
+}
+
+// value читает значение для правила. ok == false, если значения пока нет:
+// метрики нет в хранилище или для rate ещё не с чем сравнить.
+func (e *Engine) value(ctx context.Context, rs *ruleState, now time.Time) (float64, bool, error) {
+	metric, err := e.storage.GetMetricsByTypeAndName(ctx, rs.rule.SeriesID(), rs.rule.MType)
+	if errors.Is(err, store.ErrNotFound) {
+		rs.prevAt = time.Time{}
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	var value float64
+	switch {
+	case metric.Value != nil:
+		value = *metric.Value
+	case metric.Delta != nil:
+		value = float64(*metric.Delta)
+	}
+	if !rs.rule.Rate {
+		return value, true, nil
+	}
+
+	prev, prevAt := rs.prev, rs.prevAt
+	rs.prev, rs.prevAt = value, now
+	elapsed := now.Sub(prevAt).Seconds()
+	if prevAt.IsZero() || elapsed <= 0 {
+		return 0, false, nil
+	}
+	// счётчик сбросили — считаем, что он рос с нуля
+	if value < prev {
+		prev = 0
+	}
+	return (value - prev) / elapsed, true, nil
+}
+
+// transition меняет состояние правила и сообщает, перешло ли оно в firing или resolved.
+func (rs *ruleState) transition(active bool, value float64, now time.Time) bool {
+	alert := &rs.alert
+	if !active {
+		switch alert.State {
+		case StatePending:
+			*alert = Alert{Name: alert.Name, Expr: alert.Expr, Metric: alert.Metric, Labels: alert.Labels, State: StateInactive}
+		case StateFiring:
+			alert.State = StateResolved
+			alert.ResolvedAt = &now
+			return true
+		}
+		return false
+	}
+
+	alert.Value = value
+	switch alert.State {
+	case StateInactive, StateResolved:
+		alert.State = StatePending
+		alert.ActiveAt = &now
+		alert.FiredAt = nil
+		alert.ResolvedAt = nil
+	}
+	if alert.State == StatePending && now.Sub(*alert.ActiveAt) >= rs.rule.For {
+		alert.State = StateFiring
+		alert.FiredAt = &now
+		return true
+	}
+	return false
+}
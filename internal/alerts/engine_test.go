@@ -0,0 +1,208 @@
+package alerts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ypMetrics/internal/metrics"
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) now() time.Time { return c.t }
+
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestEngine(t *testing.T, lines ...string) (*Engine, *metrics.MemStorage, *testClock) {
+	t.Helper()
+	rules := make([]Rule, 0, len(lines))
+	for _, line := range lines {
+		rule, err := ParseRule(line)
+		require.NoError(t, err)
+		rules = append(rules, rule)
+	}
+	storage := metrics.NewMemStorage()
+	clock := &testClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	engine := NewEngine(storage, rules)
+	engine.now = clock.now
+	return engine, storage, clock
+}
+
+func alertState(t *testing.T, e *Engine, name string) State {
+	t.Helper()
+	for _, alert := range e.Alerts() {
+		if alert.Name == name {
+			return alert.State
+		}
+	}
+	return StateInactive
+}
+
+func TestEngineThreshold(t *testing.T) {
+	ctx := context.Background()
+	engine, storage, clock := newTestEngine(t, "heap: gauge HeapAlloc > 500MB for 2m")
+
+	// метрики ещё нет — правило неактивно
+	engine.Evaluate(ctx)
+	assert.Empty(t, engine.Alerts())
+
+	require.NoError(t, storage.UpdateGauge(ctx, "HeapAlloc", 600<<20))
+	engine.Evaluate(ctx)
+	assert.Equal(t, StatePending, alertState(t, engine, "heap"))
+
+	clock.advance(time.Minute)
+	engine.Evaluate(ctx)
+	assert.Equal(t, StatePending, alertState(t, engine, "heap"))
+
+	clock.advance(time.Minute)
+	engine.Evaluate(ctx)
+	alerts := engine.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateFiring, alerts[0].State)
+	assert.Equal(t, float64(600<<20), alerts[0].Value)
+	require.NotNil(t, alerts[0].FiredAt)
+	assert.Equal(t, clock.t, *alerts[0].FiredAt)
+
+	require.NoError(t, storage.UpdateGauge(ctx, "HeapAlloc", 100))
+	clock.advance(time.Minute)
+	engine.Evaluate(ctx)
+	alerts = engine.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateResolved, alerts[0].State)
+	require.NotNil(t, alerts[0].ResolvedAt)
+	assert.Equal(t, clock.t, *alerts[0].ResolvedAt)
+
+	// снова за порогом — новый цикл начинается с pending
+	require.NoError(t, storage.UpdateGauge(ctx, "HeapAlloc", 600<<20))
+	engine.Evaluate(ctx)
+	alerts = engine.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StatePending, alerts[0].State)
+	assert.Nil(t, alerts[0].FiredAt)
+	assert.Nil(t, alerts[0].ResolvedAt)
+}
+
+func TestEnginePendingReset(t *testing.T) {
+	ctx := context.Background()
+	engine, storage, clock := newTestEngine(t, "heap: gauge HeapAlloc{host=a} > 10 for 2m")
+
+	require.NoError(t, storage.UpdateGauge(ctx, models.SeriesID("HeapAlloc", models.Labels{"host": "a"}), 20))
+	engine.Evaluate(ctx)
+	assert.Equal(t, StatePending, alertState(t, engine, "heap"))
+
+	// условие пропало раньше For — алерт не срабатывал и не попадает в resolved
+	require.NoError(t, storage.UpdateGauge(ctx, models.SeriesID("HeapAlloc", models.Labels{"host": "a"}), 5))
+	clock.advance(time.Minute)
+	engine.Evaluate(ctx)
+	assert.Empty(t, engine.Alerts())
+}
+
+func TestEngineRate(t *testing.T) {
+	ctx := context.Background()
+	engine, storage, clock := newTestEngine(t,
+		"stuck: rate(counter PollCount) == 0 for 1m",
+		"fast: rate(counter PollCount) > 5",
+	)
+
+	_, err := storage.UpdateCounter(ctx, "PollCount", 10)
+	require.NoError(t, err)
+	// первое чтение — скорость ещё не посчитать
+	engine.Evaluate(ctx)
+	assert.Empty(t, engine.Alerts())
+
+	_, err = storage.UpdateCounter(ctx, "PollCount", 100)
+	require.NoError(t, err)
+	clock.advance(10 * time.Second)
+	engine.Evaluate(ctx)
+	assert.Equal(t, StateFiring, alertState(t, engine, "fast"), "10/s without for fires at once")
+	assert.Equal(t, StateInactive, alertState(t, engine, "stuck"))
+
+	clock.advance(30 * time.Second)
+	engine.Evaluate(ctx)
+	assert.Equal(t, StateResolved, alertState(t, engine, "fast"))
+	assert.Equal(t, StatePending, alertState(t, engine, "stuck"))
+
+	clock.advance(time.Minute)
+	engine.Evaluate(ctx)
+	assert.Equal(t, StateFiring, alertState(t, engine, "stuck"))
+
+	// после сброса счётчик считается выросшим с нуля
+	require.NoError(t, storage.ResetCounter(ctx, "PollCount"))
+	_, err = storage.UpdateCounter(ctx, "PollCount", 60)
+	require.NoError(t, err)
+	clock.advance(6 * time.Second)
+	engine.Evaluate(ctx)
+	assert.Equal(t, StateResolved, alertState(t, engine, "stuck"))
+	assert.Equal(t, StateFiring, alertState(t, engine, "fast"))
+}
+
+// blockingReads держит чтения, пока не закрыт release.
+type blockingReads struct {
+	store.Storage
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingReads) GetMetricsByTypeAndName(ctx context.Context, mName, mType string) (models.Metrics, error) {
+	s.started <- struct{}{}
+	<-s.release
+	return s.Storage.GetMetricsByTypeAndName(ctx, mName, mType)
+}
+
+func TestEngineSlowStorage(t *testing.T) {
+	ctx := context.Background()
+	rule, err := ParseRule("heap: gauge HeapAlloc > 500MB")
+	require.NoError(t, err)
+	storage := &blockingReads{Storage: metrics.NewMemStorage(), started: make(chan struct{}), release: make(chan struct{})}
+	require.NoError(t, storage.UpdateGauge(ctx, "HeapAlloc", 600<<20))
+	engine := NewEngine(storage, []Rule{rule})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		engine.Evaluate(ctx)
+	}()
+	<-storage.started
+
+	// проверка ждёт хранилище, а список алертов — нет
+	alerts := make(chan []Alert)
+	go func() { alerts <- engine.Alerts() }()
+	select {
+	case got := <-alerts:
+		assert.Empty(t, got)
+	case <-time.After(time.Second):
+		t.Fatal("Alerts is blocked by a slow evaluation")
+	}
+
+	close(storage.release)
+	<-done
+	assert.Equal(t, StateFiring, alertState(t, engine, "heap"))
+}
+
+func TestEngineRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	engine, storage, _ := newTestEngine(t, "high: gauge Alloc > 1")
+	require.NoError(t, storage.UpdateGauge(ctx, "Alloc", 2))
+
+	done := make(chan struct{})
+	go func() {
+		engine.Run(ctx, time.Hour)
+		close(done)
+	}()
+
+	// первая проверка выполняется сразу, не дожидаясь interval
+	assert.Eventually(t, func() bool {
+		return alertState(t, engine, "high") == StateFiring
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,334 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ypMetrics/models"
+)
+
+const (
+	// sendAttempts — сколько раз пробуем доставить уведомление одному получателю
+	sendAttempts = 3
+	// dispatchTick — как часто проверяем, не пора ли отправить группу
+	dispatchTick = time.Second
+)
+
+// Notification — одно уведомление о группе алертов.
+// Status — firing, если в группе есть сработавшие алерты, иначе resolved.
+type Notification struct {
+	Status string        `json:"status"`
+	Group  models.Labels `json:"group,omitempty"`
+	Alerts []Alert       `json:"alerts"`
+}
+
+// Receiver доставляет уведомления: вебхук, почта.
+type Receiver interface {
+	Name() string
+	Send(ctx context.Context, n Notification) error
+}
+
+// permanentError — ошибка, которую нет смысла повторять, например 400 от вебхука.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Dispatcher собирает изменения состояний алертов в группы и рассылает их
+// получателям. Изменения группы копятся groupWait, чтобы алерты, сработавшие
+// вместе, пришли одним уведомлением; пока в группе есть firing, уведомление
+// повторяется раз в repeatInterval. Заглушенные тишинами алерты в уведомления
+// не попадают, а об их разрешении получатели не узнают, раз не знали о срабатывании.
+type Dispatcher struct {
+	receivers      []Receiver
+	groupBy        []string
+	groupWait      time.Duration
+	repeatInterval time.Duration
+	deadLetter     *DeadLetterLog
+	silences       *Silences
+	backoff        time.Duration
+	now            func() time.Time
+
+	mu     sync.Mutex
+	groups map[string]*alertGroup
+}
+
+type alertGroup struct {
+	labels   models.Labels
+	firing   map[string]Alert
+	resolved map[string]Alert
+	// sent — алерты, о срабатывании которых получатели уже знают
+	sent map[string]bool
+	// changedAt — время первого неотправленного изменения, ноль, если их нет
+	changedAt time.Time
+	sentAt    time.Time
+}
+
+// NewDispatcher группирует алерты по значениям меток groupBy,
+// при пустом groupBy все алерты попадают в одну группу. silences может быть nil.
+func NewDispatcher(receivers []Receiver, groupBy []string, groupWait, repeatInterval time.Duration, deadLetter *DeadLetterLog, silences *Silences) *Dispatcher {
+	return &Dispatcher{
+		receivers:      receivers,
+		groupBy:        groupBy,
+		groupWait:      groupWait,
+		repeatInterval: repeatInterval,
+		deadLetter:     deadLetter,
+		silences:       silences,
+		backoff:        time.Second,
+		now:            time.Now,
+		groups:         make(map[string]*alertGroup),
+	}
+}
+
+// Add принимает алерты, сменившие состояние на firing или resolved.
+func (d *Dispatcher) Add(alerts []Alert) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	for _, alert := range alerts {
+		labels := d.groupLabels(alert)
+		key := models.SeriesID("", labels)
+		g, ok := d.groups[key]
+		if !ok {
+			g = &alertGroup{
+				labels:   labels,
+				firing:   make(map[string]Alert),
+				resolved: make(map[string]Alert),
+				sent:     make(map[string]bool),
+			}
+			d.groups[key] = g
+		}
+
+		switch alert.State {
+		case StateFiring:
+			g.firing[alert.Name] = alert
+			delete(g.resolved, alert.Name)
+		case StateResolved:
+			delete(g.firing, alert.Name)
+			if !g.sent[alert.Name] || d.muted(alert) {
+				delete(g.sent, alert.Name)
+				continue
+			}
+			g.resolved[alert.Name] = alert
+		default:
+			continue
+		}
+		if g.changedAt.IsZero() {
+			g.changedAt = now
+		}
+	}
+}
+
+// Run раз в секунду отправляет группы, которым пора, пока не отменён ctx.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(dispatchTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.Flush(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Flush отправляет группы, у которых истёк groupWait после изменения
+// или repeatInterval после прошлой отправки.
+func (d *Dispatcher) Flush(ctx context.Context) {
+	for _, n := range d.due() {
+		for _, r := range d.receivers {
+			if err := d.send(ctx, r, n); err != nil {
+				log.Printf("Error sending alert notification to %s: %v", r.Name(), err)
+				d.deadLetter.Write(r.Name(), n, err)
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) due() []Notification {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	var notifications []Notification
+	for key, g := range d.groups {
+		// news — есть то, чего получатели ещё не видели: новый firing
+		// (в том числе после окончания тишины) или разрешение
+		news := len(g.resolved) > 0
+		visible := make([]Alert, 0, len(g.firing))
+		for _, alert := range g.firing {
+			if d.muted(alert) {
+				continue
+			}
+			visible = append(visible, alert)
+			if !g.sent[alert.Name] {
+				news = true
+				if g.changedAt.IsZero() {
+					g.changedAt = now
+				}
+			}
+		}
+
+		changed := !g.changedAt.IsZero() && !now.Before(g.changedAt.Add(d.groupWait))
+		repeat := len(visible) > 0 && !g.sentAt.IsZero() && !now.Before(g.sentAt.Add(d.repeatInterval))
+		if changed && !news {
+			// изменились только заглушенные алерты
+			g.changedAt = time.Time{}
+			changed = false
+		}
+		if !changed && !repeat {
+			if len(g.firing) == 0 && len(g.resolved) == 0 {
+				delete(d.groups, key)
+			}
+			continue
+		}
+
+		n := g.notification(visible)
+		g.resolved = make(map[string]Alert)
+		g.changedAt = time.Time{}
+		if len(n.Alerts) > 0 {
+			notifications = append(notifications, n)
+			g.sentAt = now
+			g.sent = make(map[string]bool, len(visible))
+			for _, alert := range visible {
+				g.sent[alert.Name] = true
+			}
+		}
+		if len(g.firing) == 0 {
+			delete(d.groups, key)
+		}
+	}
+	return notifications
+}
+
+func (d *Dispatcher) muted(alert Alert) bool {
+	return d.silences != nil && d.silences.Muted(alert)
+}
+
+func (d *Dispatcher) groupLabels(alert Alert) models.Labels {
+	if len(d.groupBy) == 0 {
+		return nil
+	}
+	labels := make(models.Labels)
+	for _, name := range d.groupBy {
+		if value, ok := alert.Labels[name]; ok {
+			labels[name] = value
+		}
+	}
+	return labels
+}
+
+// send пробует доставить уведомление несколько раз с растущей паузой.
+func (d *Dispatcher) send(ctx context.Context, r Receiver, n Notification) error {
+	var err error
+	delay := d.backoff
+	for attempt := 1; ; attempt++ {
+		if err = r.Send(ctx, n); err == nil {
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt == sendAttempts {
+			return err
+		}
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		}
+	}
+}
+
+func (g *alertGroup) notification(firing []Alert) Notification {
+	n := Notification{Status: string(StateResolved), Group: g.labels}
+	if len(firing) > 0 {
+		n.Status = string(StateFiring)
+	}
+	n.Alerts = append(n.Alerts, firing...)
+	for _, alert := range g.resolved {
+		n.Alerts = append(n.Alerts, alert)
+	}
+	sort.Slice(n.Alerts, func(i, j int) bool {
+		return n.Alerts[i].Name < n.Alerts[j].Name
+	})
+	return n
+}
+
+// Summary — короткое описание для заголовка письма: "[FIRING:2] heap_high, agent_stuck".
+func (n Notification) Summary() string {
+	names := make([]string, 0, len(n.Alerts))
+	firing := 0
+	for _, alert := range n.Alerts {
+		names = append(names, alert.Name)
+		if alert.State == StateFiring {
+			firing++
+		}
+	}
+	if n.Status == string(StateFiring) {
+		return fmt.Sprintf("[FIRING:%d] %s", firing, strings.Join(names, ", "))
+	}
+	return fmt.Sprintf("[RESOLVED] %s", strings.Join(names, ", "))
+}
+
+// DeadLetterLog дописывает недоставленные уведомления в файл по одному JSON
+// на строку, чтобы их можно было разобрать и переотправить вручную.
+// Без пути уведомления только пишутся в лог.
+type DeadLetterLog struct {
+	path string
+	now  func() time.Time
+	mu   sync.Mutex
+}
+
+type deadLetter struct {
+	Time         time.Time    `json:"time"`
+	Receiver     string       `json:"receiver"`
+	Error        string       `json:"error"`
+	Notification Notification `json:"notification"`
+}
+
+func NewDeadLetterLog(path string) *DeadLetterLog {
+	return &DeadLetterLog{path: path, now: time.Now}
+}
+
+func (l *DeadLetterLog) Write(receiver string, n Notification, sendErr error) {
+	data, err := json.Marshal(deadLetter{
+		Time:         l.now(),
+		Receiver:     receiver,
+		Error:        sendErr.Error(),
+		Notification: n,
+	})
+	if err != nil {
+		log.Printf("Error marshaling dead letter: %v", err)
+		return
+	}
+	if l.path == "" {
+		log.Printf("Dead letter: %s", data)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Printf("Error opening dead letter log %s: %v", l.path, err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		log.Printf("Error writing dead letter log %s: %v", l.path, err)
+	}
+}
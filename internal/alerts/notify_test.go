@@ -0,0 +1,213 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ypMetrics/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testReceiver запоминает уведомления и отвечает ошибками из errs по очереди.
+type testReceiver struct {
+	mu            sync.Mutex
+	notifications []Notification
+	calls         int
+	errs          []error
+}
+
+func (r *testReceiver) Name() string { return "test" }
+
+func (r *testReceiver) Send(ctx context.Context, n Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if len(r.errs) > 0 {
+		err := r.errs[0]
+		r.errs = r.errs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	r.notifications = append(r.notifications, n)
+	return nil
+}
+
+func alertNames(n Notification) []string {
+	names := make([]string, 0, len(n.Alerts))
+	for _, alert := range n.Alerts {
+		names = append(names, alert.Name)
+	}
+	return names
+}
+
+func newTestDispatcher(receiver Receiver, groupBy []string, deadLetter string) (*Dispatcher, *testClock) {
+	clock := &testClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	d := NewDispatcher([]Receiver{receiver}, groupBy, 10*time.Second, time.Hour, NewDeadLetterLog(deadLetter), nil)
+	d.now = clock.now
+	d.backoff = time.Millisecond
+	return d, clock
+}
+
+func TestDispatcherGrouping(t *testing.T) {
+	ctx := context.Background()
+	receiver := &testReceiver{}
+	d, clock := newTestDispatcher(receiver, []string{"host"}, "")
+
+	d.Add([]Alert{
+		{Name: "heap", State: StateFiring, Labels: models.Labels{"host": "a"}},
+		{Name: "cpu", State: StateFiring, Labels: models.Labels{"host": "a", "core": "1"}},
+		{Name: "disk", State: StateFiring, Labels: models.Labels{"host": "b"}},
+	})
+
+	// до истечения groupWait ничего не уходит
+	clock.advance(5 * time.Second)
+	d.Flush(ctx)
+	assert.Empty(t, receiver.notifications)
+
+	clock.advance(5 * time.Second)
+	d.Flush(ctx)
+	require.Len(t, receiver.notifications, 2)
+	groups := make(map[string][]string)
+	for _, n := range receiver.notifications {
+		assert.Equal(t, "firing", n.Status)
+		groups[n.Group["host"]] = alertNames(n)
+	}
+	assert.Equal(t, map[string][]string{"a": {"cpu", "heap"}, "b": {"disk"}}, groups)
+
+	// без изменений повторной отправки нет
+	d.Flush(ctx)
+	assert.Len(t, receiver.notifications, 2)
+}
+
+func TestDispatcherResolveAndRepeat(t *testing.T) {
+	ctx := context.Background()
+	receiver := &testReceiver{}
+	d, clock := newTestDispatcher(receiver, nil, "")
+
+	d.Add([]Alert{{Name: "heap", State: StateFiring}, {Name: "cpu", State: StateFiring}})
+	clock.advance(10 * time.Second)
+	d.Flush(ctx)
+	require.Len(t, receiver.notifications, 1)
+	assert.Equal(t, []string{"cpu", "heap"}, alertNames(receiver.notifications[0]))
+
+	// одна из двух разрешилась — в уведомлении и оставшийся firing, и resolved
+	d.Add([]Alert{{Name: "cpu", State: StateResolved}})
+	clock.advance(10 * time.Second)
+	d.Flush(ctx)
+	require.Len(t, receiver.notifications, 2)
+	n := receiver.notifications[1]
+	assert.Equal(t, "firing", n.Status)
+	assert.Equal(t, []string{"cpu", "heap"}, alertNames(n))
+	assert.Equal(t, "[FIRING:1] cpu, heap", n.Summary())
+
+	// пока heap горит, уведомление повторяется раз в repeatInterval
+	clock.advance(30 * time.Minute)
+	d.Flush(ctx)
+	assert.Len(t, receiver.notifications, 2)
+	clock.advance(30 * time.Minute)
+	d.Flush(ctx)
+	require.Len(t, receiver.notifications, 3)
+	assert.Equal(t, []string{"heap"}, alertNames(receiver.notifications[2]))
+
+	d.Add([]Alert{{Name: "heap", State: StateResolved}})
+	d.Flush(ctx)
+	assert.Len(t, receiver.notifications, 3, "resolved waits groupWait too")
+	clock.advance(10 * time.Second)
+	d.Flush(ctx)
+	require.Len(t, receiver.notifications, 4)
+	assert.Equal(t, "resolved", receiver.notifications[3].Status)
+	assert.Equal(t, "[RESOLVED] heap", receiver.notifications[3].Summary())
+
+	// группа без firing удалена и больше не повторяется
+	clock.advance(2 * time.Hour)
+	d.Flush(ctx)
+	assert.Len(t, receiver.notifications, 4)
+}
+
+func TestDispatcherRetryAndDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	deadLetterPath := filepath.Join(t.TempDir(), "dead.jsonl")
+
+	t.Run("retried until success", func(t *testing.T) {
+		receiver := &testReceiver{errs: []error{errors.New("timeout"), errors.New("timeout")}}
+		d, clock := newTestDispatcher(receiver, nil, deadLetterPath)
+		d.Add([]Alert{{Name: "heap", State: StateFiring}})
+		clock.advance(10 * time.Second)
+		d.Flush(ctx)
+
+		assert.Equal(t, 3, receiver.calls)
+		assert.Len(t, receiver.notifications, 1)
+		assert.NoFileExists(t, deadLetterPath)
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		receiver := &testReceiver{errs: []error{errors.New("timeout"), errors.New("timeout"), errors.New("refused")}}
+		d, clock := newTestDispatcher(receiver, nil, deadLetterPath)
+		d.Add([]Alert{{Name: "heap", State: StateFiring}})
+		clock.advance(10 * time.Second)
+		d.Flush(ctx)
+
+		assert.Equal(t, sendAttempts, receiver.calls)
+		assert.Empty(t, receiver.notifications)
+	})
+
+	t.Run("permanent error is not retried", func(t *testing.T) {
+		receiver := &testReceiver{errs: []error{&permanentError{err: errors.New("bad request")}}}
+		d, clock := newTestDispatcher(receiver, nil, deadLetterPath)
+		d.Add([]Alert{{Name: "cpu", State: StateFiring}})
+		clock.advance(10 * time.Second)
+		d.Flush(ctx)
+
+		assert.Equal(t, 1, receiver.calls)
+	})
+
+	data, err := os.ReadFile(deadLetterPath)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+
+	var letter deadLetter
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &letter))
+	assert.Equal(t, "test", letter.Receiver)
+	assert.Equal(t, "refused", letter.Error)
+	assert.Equal(t, []string{"heap"}, alertNames(letter.Notification))
+
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &letter))
+	assert.Equal(t, "bad request", letter.Error)
+}
+
+func TestEngineOnChange(t *testing.T) {
+	ctx := context.Background()
+	engine, storage, clock := newTestEngine(t, "heap: gauge HeapAlloc > 10 for 1m")
+	var changes [][]Alert
+	engine.OnChange(func(alerts []Alert) {
+		changes = append(changes, alerts)
+	})
+
+	require.NoError(t, storage.UpdateGauge(ctx, "HeapAlloc", 20))
+	engine.Evaluate(ctx)
+	assert.Empty(t, changes, "pending is not reported")
+
+	clock.advance(time.Minute)
+	engine.Evaluate(ctx)
+	require.Len(t, changes, 1)
+	assert.Equal(t, StateFiring, changes[0][0].State)
+
+	engine.Evaluate(ctx)
+	assert.Len(t, changes, 1, "still firing is not a change")
+
+	require.NoError(t, storage.UpdateGauge(ctx, "HeapAlloc", 1))
+	engine.Evaluate(ctx)
+	require.Len(t, changes, 2)
+	assert.Equal(t, StateResolved, changes[1][0].State)
+}
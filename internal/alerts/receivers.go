@@ -0,0 +1,162 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// sendTimeout ограничивает одну попытку доставки, если у ctx нет своего дедлайна.
+const sendTimeout = 10 * time.Second
+
+// WebhookReceiver отправляет уведомление POST-запросом с JSON в теле.
+type WebhookReceiver struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookReceiver(url string) *WebhookReceiver {
+	return &WebhookReceiver{url: url, client: &http.Client{Timeout: sendTimeout}}
+}
+
+func (r *WebhookReceiver) Name() string {
+	return "webhook " + r.url
+}
+
+// Send считает ответы 4xx, кроме 429, окончательной ошибкой: повтор не поможет.
+func (r *WebhookReceiver) Send(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return &permanentError{err: fmt.Errorf("failed to marshal notification: %w", err)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("webhook responded with %s", resp.Status)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err: err}
+	}
+	return err
+}
+
+// SMTPReceiver отправляет уведомление письмом. Если сервер умеет STARTTLS,
+// соединение шифруется; авторизация — PLAIN, когда задан username.
+type SMTPReceiver struct {
+	addr     string
+	from     string
+	to       []string
+	username string
+	password string
+}
+
+func NewSMTPReceiver(addr, from string, to []string, username, password string) *SMTPReceiver {
+	return &SMTPReceiver{addr: addr, from: from, to: to, username: username, password: password}
+}
+
+func (r *SMTPReceiver) Name() string {
+	return "smtp " + r.addr
+}
+
+// Send повторяет smtp.SendMail, но с учётом ctx: net/smtp сам таймаутов не ставит.
+func (r *SMTPReceiver) Send(ctx context.Context, n Notification) error {
+	host, _, err := net.SplitHostPort(r.addr)
+	if err != nil {
+		return &permanentError{err: fmt.Errorf("invalid smtp address: %w", err)}
+	}
+
+	conn, err := (&net.Dialer{Timeout: sendTimeout}).DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(sendTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if r.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", r.username, r.password, host)); err != nil {
+			return &permanentError{err: err}
+		}
+	}
+	if err := client.Mail(r.from); err != nil {
+		return err
+	}
+	for _, to := range r.to {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(r.message(n)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (r *SMTPReceiver) message(n Notification) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", r.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(r.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Summary()))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+
+	for _, alert := range n.Alerts {
+		fmt.Fprintf(&b, "%s [%s]\r\n", alert.Name, alert.State)
+		fmt.Fprintf(&b, "  %s\r\n", alert.Expr)
+		fmt.Fprintf(&b, "  value: %g\r\n", alert.Value)
+		if alert.ActiveAt != nil {
+			fmt.Fprintf(&b, "  active since: %s\r\n", alert.ActiveAt.Format(time.RFC3339))
+		}
+		if alert.ResolvedAt != nil {
+			fmt.Fprintf(&b, "  resolved at: %s\r\n", alert.ResolvedAt.Format(time.RFC3339))
+		}
+		b.WriteString("\r\n")
+	}
+	return []byte(b.String())
+}
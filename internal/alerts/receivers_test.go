@@ -0,0 +1,145 @@
+package alerts
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testNotification() Notification {
+	firedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	return Notification{
+		Status: "firing",
+		Alerts: []Alert{{Name: "heap", Expr: "gauge HeapAlloc > 500MB", State: StateFiring, Value: 600 << 20, ActiveAt: &firedAt, FiredAt: &firedAt}},
+	}
+}
+
+func TestWebhookReceiver(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		wantErr       bool
+		wantPermanent bool
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "server error is retryable", status: http.StatusBadGateway, wantErr: true},
+		{name: "too many requests is retryable", status: http.StatusTooManyRequests, wantErr: true},
+		{name: "bad request is permanent", status: http.StatusBadRequest, wantErr: true, wantPermanent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Notification
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			err := NewWebhookReceiver(server.URL).Send(context.Background(), testNotification())
+
+			var permanent *permanentError
+			assert.Equal(t, tt.wantErr, err != nil, err)
+			assert.Equal(t, tt.wantPermanent, errors.As(err, &permanent))
+			require.Len(t, got.Alerts, 1)
+			assert.Equal(t, "heap", got.Alerts[0].Name)
+		})
+	}
+}
+
+// startSMTPStandIn — минимальный SMTP-сервер без TLS и авторизации:
+// принимает письма и отдаёт тело каждого в канал.
+func startSMTPStandIn(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+	return listener.Addr().String(), messages
+}
+
+func serveSMTP(conn net.Conn, messages chan<- string) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP stand-in")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.Fields(line + " ")[0]); cmd {
+		case "EHLO", "HELO", "MAIL", "RCPT", "RSET", "NOOP":
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			messages <- string(data)
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTPReceiver(t *testing.T) {
+	addr, messages := startSMTPStandIn(t)
+	receiver := NewSMTPReceiver(addr, "alerts@example.com", []string{"ops@example.com", "dev@example.com"}, "", "")
+
+	require.NoError(t, receiver.Send(context.Background(), testNotification()))
+
+	var message string
+	select {
+	case message = <-messages:
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+	}
+	headers, err := textproto.NewReader(bufio.NewReader(strings.NewReader(message))).ReadMIMEHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "alerts@example.com", headers.Get("From"))
+	assert.Equal(t, "ops@example.com, dev@example.com", headers.Get("To"))
+	assert.Equal(t, "[FIRING:1] heap", headers.Get("Subject"))
+	assert.Contains(t, message, "heap [firing]")
+	assert.Contains(t, message, "gauge HeapAlloc > 500MB")
+	assert.Contains(t, message, "active since: 2024-01-01T12:00:00Z")
+}
+
+func TestSMTPReceiverUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	err = NewSMTPReceiver(addr, "alerts@example.com", []string{"ops@example.com"}, "", "").Send(context.Background(), testNotification())
+
+	var permanent *permanentError
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &permanent), "connection errors are retried")
+}
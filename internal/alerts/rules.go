@@ -0,0 +1,215 @@
+package alerts
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"ypMetrics/models"
+)
+
+var ErrInvalidRule = errors.New("invalid alert rule")
+
+// Op — оператор сравнения значения с порогом.
+type Op string
+
+const (
+	OpGreater      Op = ">"
+	OpGreaterEqual Op = ">="
+	OpLess         Op = "<"
+	OpLessEqual    Op = "<="
+	OpEqual        Op = "=="
+	OpNotEqual     Op = "!="
+)
+
+// Rule — правило алерта: значение серии (или скорость роста счётчика)
+// сравнивается с порогом, и если условие держится не меньше For, алерт срабатывает.
+type Rule struct {
+	Name      string
+	Expr      string
+	MType     string
+	Metric    string
+	Labels    models.Labels
+	Rate      bool
+	Op        Op
+	Threshold float64
+	For       time.Duration
+}
+
+// SeriesID — ключ серии правила в хранилище.
+func (r Rule) SeriesID() string {
+	return models.SeriesID(r.Metric, r.Labels)
+}
+
+// Match сравнивает значение с порогом.
+func (r Rule) Match(value float64) bool {
+	switch r.Op {
+	case OpGreater:
+		return value > r.Threshold
+	case OpGreaterEqual:
+		return value >= r.Threshold
+	case OpLess:
+		return value < r.Threshold
+	case OpLessEqual:
+		return value <= r.Threshold
+	case OpEqual:
+		return value == r.Threshold
+	case OpNotEqual:
+		return value != r.Threshold
+	}
+	return false
+}
+
+// [имя:] (тип метрика | rate(counter метрика)) оператор порог [for длительность]
+var ruleRe = regexp.MustCompile(`^(?:([A-Za-z_][\w.\-]*):\s+)?` +
+	`(?:rate\(\s*(\w+)\s+([^\s{}()<>=!]+(?:\{[^}]*\})?)\s*\)|(\w+)\s+([^\s{}()<>=!]+(?:\{[^}]*\})?))` +
+	`\s*(>=|<=|==|!=|>|<)\s*(\S+)` +
+	`(?:\s+for\s+(\S+))?$`)
+
+// ParseRule разбирает одно правило, например
+// "heap: gauge HeapAlloc{host=a} > 500MB for 2m" или "rate(counter PollCount) == 0 for 1m".
+// Без имени именем правила становится само выражение.
+func ParseRule(line string) (Rule, error) {
+	line = strings.TrimSpace(line)
+	m := ruleRe.FindStringSubmatch(line)
+	if m == nil {
+		return Rule{}, fmt.Errorf("%w: %q", ErrInvalidRule, line)
+	}
+
+	rule := Rule{Name: m[1], Op: Op(m[6])}
+	if rule.Name != "" {
+		rule.Expr = strings.TrimSpace(strings.TrimPrefix(line, rule.Name+":"))
+	} else {
+		rule.Expr = line
+		rule.Name = line
+	}
+
+	metric := m[5]
+	rule.MType = m[4]
+	if m[2] != "" {
+		rule.Rate = true
+		rule.MType = m[2]
+		metric = m[3]
+		if rule.MType != models.Counter {
+			return Rule{}, fmt.Errorf("%w: rate() needs a counter, got '%s'", ErrInvalidRule, rule.MType)
+		}
+	}
+	if rule.MType != models.Gauge && rule.MType != models.Counter {
+		return Rule{}, fmt.Errorf("%w: unsupported metric type '%s'", ErrInvalidRule, rule.MType)
+	}
+
+	var err error
+	if rule.Metric, rule.Labels, err = parseSelector(metric); err != nil {
+		return Rule{}, err
+	}
+	if rule.Threshold, err = parseThreshold(m[7]); err != nil {
+		return Rule{}, err
+	}
+	if m[8] != "" {
+		if rule.For, err = time.ParseDuration(m[8]); err != nil || rule.For < 0 {
+			return Rule{}, fmt.Errorf("%w: invalid for duration '%s'", ErrInvalidRule, m[8])
+		}
+	}
+	return rule, nil
+}
+
+// ParseRules читает правила по одному на строку. Пустые строки
+// и всё после # пропускаются, имена правил должны быть уникальны.
+func ParseRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	names := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rule, err := ParseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		if prev, ok := names[rule.Name]; ok {
+			return nil, fmt.Errorf("line %d: %w: name '%s' is already used on line %d", lineNum, ErrInvalidRule, rule.Name, prev)
+		}
+		names[rule.Name] = lineNum
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// LoadRules читает правила из файла.
+func LoadRules(path string) ([]Rule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open alert rules: %w", err)
+	}
+	defer file.Close()
+
+	rules, err := ParseRules(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// parseSelector разбирает "Name" или "Name{k=v,k2=\"v2\"}".
+func parseSelector(s string) (string, models.Labels, error) {
+	name, rest, ok := strings.Cut(s, "{")
+	if !ok {
+		return name, nil, nil
+	}
+
+	labels := make(models.Labels)
+	for _, pair := range strings.Split(strings.TrimSuffix(rest, "}"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return "", nil, fmt.Errorf("%w: label '%s' has no value", ErrInvalidRule, pair)
+		}
+		labels[strings.TrimSpace(k)] = strings.Trim(strings.TrimSpace(v), `"`)
+	}
+	if err := labels.Validate(); err != nil {
+		return "", nil, fmt.Errorf("%w: %w", ErrInvalidRule, err)
+	}
+	return name, labels, nil
+}
+
+// sizeSuffixes — двоичные множители, как у байтовых метрик runtime.
+var sizeSuffixes = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"KB", 1 << 10},
+	{"MB", 1 << 20},
+	{"GB", 1 << 30},
+	{"TB", 1 << 40},
+}
+
+func parseThreshold(s string) (float64, error) {
+	multiplier := 1.0
+	number := s
+	for _, size := range sizeSuffixes {
+		if strings.HasSuffix(s, size.suffix) {
+			number = strings.TrimSuffix(s, size.suffix)
+			multiplier = size.multiplier
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid threshold '%s'", ErrInvalidRule, s)
+	}
+	return value * multiplier, nil
+}
@@ -0,0 +1,101 @@
+package alerts
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ypMetrics/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Rule
+		wantErr bool
+	}{
+		{
+			name: "gauge with size and for",
+			line: "gauge HeapAlloc > 500MB for 2m",
+			want: Rule{
+				Name: "gauge HeapAlloc > 500MB for 2m", Expr: "gauge HeapAlloc > 500MB for 2m",
+				MType: models.Gauge, Metric: "HeapAlloc", Op: OpGreater, Threshold: 500 << 20, For: 2 * time.Minute,
+			},
+		},
+		{
+			name: "named counter rate",
+			line: "  stuck: rate(counter PollCount) == 0 for 1m ",
+			want: Rule{
+				Name: "stuck", Expr: "rate(counter PollCount) == 0 for 1m",
+				MType: models.Counter, Metric: "PollCount", Rate: true, Op: OpEqual, Threshold: 0, For: time.Minute,
+			},
+		},
+		{
+			name: "labels without spaces around operator",
+			line: `gauge Alloc{host="a",region=eu}<=1.5`,
+			want: Rule{
+				Name: `gauge Alloc{host="a",region=eu}<=1.5`, Expr: `gauge Alloc{host="a",region=eu}<=1.5`,
+				MType: models.Gauge, Metric: "Alloc", Labels: models.Labels{"host": "a", "region": "eu"},
+				Op: OpLessEqual, Threshold: 1.5,
+			},
+		},
+		{name: "unknown type", line: "histogram Latency > 1", wantErr: true},
+		{name: "rate of gauge", line: "rate(gauge Alloc) > 1", wantErr: true},
+		{name: "bad threshold", line: "gauge Alloc > lots", wantErr: true},
+		{name: "bad for", line: "gauge Alloc > 1 for soon", wantErr: true},
+		{name: "empty label", line: "gauge Alloc{host=} > 1", wantErr: true},
+		{name: "no operator", line: "gauge Alloc 1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRule(tt.line)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidRule)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(`
+# память
+heap: gauge HeapAlloc > 500MB for 2m
+
+stuck: rate(counter PollCount) == 0 for 1m # агент перестал слать метрики
+`))
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, "heap", rules[0].Name)
+	assert.Equal(t, "stuck", rules[1].Name)
+
+	_, err = ParseRules(strings.NewReader("a: gauge X > 1\na: gauge Y > 1\n"))
+	assert.ErrorIs(t, err, ErrInvalidRule)
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestRuleMatch(t *testing.T) {
+	tests := []struct {
+		op    Op
+		value float64
+		want  bool
+	}{
+		{OpGreater, 2, true},
+		{OpGreater, 1, false},
+		{OpGreaterEqual, 1, true},
+		{OpLess, 0, true},
+		{OpLessEqual, 2, false},
+		{OpEqual, 1, true},
+		{OpNotEqual, 1, false},
+	}
+	for _, tt := range tests {
+		rule := Rule{Op: tt.op, Threshold: 1}
+		assert.Equal(t, tt.want, rule.Match(tt.value), "%v %s 1", tt.value, tt.op)
+	}
+}
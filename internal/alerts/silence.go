@@ -0,0 +1,228 @@
+package alerts
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+)
+
+// silencesKey — ключ тишин в store.StateStore.
+const silencesKey = "silences"
+
+var (
+	ErrSilenceNotFound = errors.New("silence not found")
+	ErrInvalidSilence  = errors.New("invalid silence")
+)
+
+// Silence глушит уведомления об алертах, подходящих под Metric и Labels,
+// с StartsAt до EndsAt. Metric — имя метрики правила или шаблон path.Match
+// ("Poll*"), Labels должны совпасть все. Пустой Metric подходит к любой метрике.
+type Silence struct {
+	ID        string        `json:"id"`
+	Metric    string        `json:"metric,omitempty"`
+	Labels    models.Labels `json:"labels,omitempty"`
+	StartsAt  time.Time     `json:"startsAt"`
+	EndsAt    time.Time     `json:"endsAt"`
+	CreatedBy string        `json:"createdBy,omitempty"`
+	Comment   string        `json:"comment,omitempty"`
+}
+
+// Validate требует хотя бы один критерий: тишина на всё подряд скорее ошибка.
+func (s Silence) Validate() error {
+	if s.Metric == "" && len(s.Labels) == 0 {
+		return fmt.Errorf("%w: metric or labels are required", ErrInvalidSilence)
+	}
+	if _, err := path.Match(s.Metric, ""); err != nil {
+		return fmt.Errorf("%w: bad metric pattern '%s'", ErrInvalidSilence, s.Metric)
+	}
+	if err := s.Labels.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSilence, err)
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return fmt.Errorf("%w: endsAt must be after startsAt", ErrInvalidSilence)
+	}
+	return nil
+}
+
+// Active сообщает, действует ли тишина в момент now.
+func (s Silence) Active(now time.Time) bool {
+	return !now.Before(s.StartsAt) && now.Before(s.EndsAt)
+}
+
+// Matches сообщает, подходит ли алерт под тишину, без учёта времени.
+func (s Silence) Matches(alert Alert) bool {
+	if s.Metric != "" {
+		if ok, _ := path.Match(s.Metric, alert.Metric); !ok {
+			return false
+		}
+	}
+	for k, v := range s.Labels {
+		if alert.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Silences — набор тишин. Если хранилище метрик умеет store.StateStore,
+// тишины сохраняются в нём и переживают перезапуск, иначе живут в памяти.
+// Истёкшие тишины удаляются при следующем изменении набора.
+type Silences struct {
+	state store.StateStore
+	now   func() time.Time
+
+	mu    sync.RWMutex
+	items map[string]Silence
+}
+
+// NewSilences загружает сохранённые тишины; state может быть nil.
+func NewSilences(ctx context.Context, state store.StateStore) (*Silences, error) {
+	s := &Silences{
+		state: state,
+		now:   time.Now,
+		items: make(map[string]Silence),
+	}
+	if state == nil {
+		return s, nil
+	}
+
+	data, err := state.LoadState(ctx, silencesKey)
+	if errors.Is(err, store.ErrNotFound) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load silences: %w", err)
+	}
+	var items []Silence
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("failed to parse silences: %w", err)
+	}
+	for _, item := range items {
+		s.items[item.ID] = item
+	}
+	return s, nil
+}
+
+// Add проверяет тишину, присваивает ей ID и сохраняет. Без StartsAt она
+// начинается сразу.
+func (s *Silences) Add(ctx context.Context, silence Silence) (Silence, error) {
+	if silence.StartsAt.IsZero() {
+		silence.StartsAt = s.now()
+	}
+	if err := silence.Validate(); err != nil {
+		return Silence{}, err
+	}
+	if !silence.EndsAt.After(s.now()) {
+		return Silence{}, fmt.Errorf("%w: silence has already ended", ErrInvalidSilence)
+	}
+
+	id, err := newSilenceID()
+	if err != nil {
+		return Silence{}, err
+	}
+	silence.ID = id
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[id] = silence
+	if err := s.save(ctx); err != nil {
+		delete(s.items, id)
+		return Silence{}, err
+	}
+	return silence, nil
+}
+
+func (s *Silences) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	silence, ok := s.items[id]
+	if !ok {
+		return fmt.Errorf("%w: '%s'", ErrSilenceNotFound, id)
+	}
+	delete(s.items, id)
+	if err := s.save(ctx); err != nil {
+		s.items[id] = silence
+		return err
+	}
+	return nil
+}
+
+// List возвращает неистёкшие тишины: действующие и запланированные.
+func (s *Silences) List() []Silence {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now()
+	list := make([]Silence, 0, len(s.items))
+	for _, silence := range s.items {
+		if now.Before(silence.EndsAt) {
+			list = append(list, silence)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].StartsAt.Equal(list[j].StartsAt) {
+			return list[i].StartsAt.Before(list[j].StartsAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Muted сообщает, заглушен ли алерт прямо сейчас.
+func (s *Silences) Muted(alert Alert) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now()
+	for _, silence := range s.items {
+		if silence.Active(now) && silence.Matches(alert) {
+			return true
+		}
+	}
+	return false
+}
+
+// save вызывается под s.mu и заодно выбрасывает истёкшие тишины.
+func (s *Silences) save(ctx context.Context) error {
+	now := s.now()
+	items := make([]Silence, 0, len(s.items))
+	for id, silence := range s.items {
+		if !now.Before(silence.EndsAt) {
+			delete(s.items, id)
+			continue
+		}
+		items = append(items, silence)
+	}
+	if s.state == nil {
+		return nil
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	data, err := json.Marshal(items)
+	if err != nil {
+		return fmt.Errorf("failed to marshal silences: %w", err)
+	}
+	if err := s.state.SaveState(ctx, silencesKey, data); err != nil {
+		return fmt.Errorf("failed to save silences: %w", err)
+	}
+	return nil
+}
+
+func newSilenceID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate silence id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
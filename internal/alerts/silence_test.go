@@ -0,0 +1,162 @@
+package alerts
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ypMetrics/internal/metrics"
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSilenceMatches(t *testing.T) {
+	alert := Alert{Name: "stuck", Metric: "PollCount", Labels: models.Labels{"host": "a", "env": "prod"}}
+
+	tests := []struct {
+		name    string
+		silence Silence
+		want    bool
+	}{
+		{name: "metric", silence: Silence{Metric: "PollCount"}, want: true},
+		{name: "metric pattern", silence: Silence{Metric: "Poll*"}, want: true},
+		{name: "other metric", silence: Silence{Metric: "HeapAlloc"}, want: false},
+		{name: "labels subset", silence: Silence{Labels: models.Labels{"host": "a"}}, want: true},
+		{name: "label mismatch", silence: Silence{Metric: "PollCount", Labels: models.Labels{"host": "b"}}, want: false},
+		{name: "missing label", silence: Silence{Labels: models.Labels{"region": "eu"}}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.silence.Matches(alert))
+		})
+	}
+}
+
+func TestSilenceValidate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		silence Silence
+		wantErr bool
+	}{
+		{name: "ok", silence: Silence{Metric: "PollCount", StartsAt: start, EndsAt: start.Add(time.Hour)}},
+		{name: "no matcher", silence: Silence{StartsAt: start, EndsAt: start.Add(time.Hour)}, wantErr: true},
+		{name: "bad pattern", silence: Silence{Metric: "Poll[", StartsAt: start, EndsAt: start.Add(time.Hour)}, wantErr: true},
+		{name: "empty label", silence: Silence{Labels: models.Labels{"host": ""}, StartsAt: start, EndsAt: start.Add(time.Hour)}, wantErr: true},
+		{name: "ends before start", silence: Silence{Metric: "PollCount", StartsAt: start, EndsAt: start}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.silence.Validate()
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidSilence)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSilences(t *testing.T) {
+	ctx := context.Background()
+	clock := &testClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	silences, err := NewSilences(ctx, nil)
+	require.NoError(t, err)
+	silences.now = clock.now
+
+	alert := Alert{Name: "stuck", Metric: "PollCount"}
+
+	deploy, err := silences.Add(ctx, Silence{Metric: "PollCount", EndsAt: clock.t.Add(30 * time.Minute), Comment: "deploy"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, deploy.ID)
+	assert.Equal(t, clock.t, deploy.StartsAt)
+	assert.True(t, silences.Muted(alert))
+
+	planned, err := silences.Add(ctx, Silence{Metric: "HeapAlloc", StartsAt: clock.t.Add(time.Hour), EndsAt: clock.t.Add(2 * time.Hour)})
+	require.NoError(t, err)
+	assert.False(t, silences.Muted(Alert{Metric: "HeapAlloc"}), "planned silence is not active yet")
+	assert.Equal(t, []Silence{deploy, planned}, silences.List())
+
+	_, err = silences.Add(ctx, Silence{Metric: "PollCount", StartsAt: clock.t.Add(-time.Hour), EndsAt: clock.t.Add(-time.Minute)})
+	assert.ErrorIs(t, err, ErrInvalidSilence)
+
+	clock.advance(30 * time.Minute)
+	assert.False(t, silences.Muted(alert), "silence ended")
+	assert.Equal(t, []Silence{planned}, silences.List())
+
+	require.NoError(t, silences.Delete(ctx, planned.ID))
+	assert.ErrorIs(t, silences.Delete(ctx, planned.ID), ErrSilenceNotFound)
+	assert.Empty(t, silences.List())
+}
+
+func TestSilencesPersisted(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+	storage, err := store.NewFileStorage(metrics.NewMemStorage(), path, 0, false)
+	require.NoError(t, err)
+	history := store.NewHistoryStorage(storage, time.Hour)
+
+	state, ok := store.As[store.StateStore](history)
+	require.True(t, ok)
+	silences, err := NewSilences(ctx, state)
+	require.NoError(t, err)
+
+	kept, err := silences.Add(ctx, Silence{Metric: "PollCount", EndsAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	deleted, err := silences.Add(ctx, Silence{Labels: models.Labels{"host": "a"}, EndsAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	require.NoError(t, silences.Delete(ctx, deleted.ID))
+	assert.FileExists(t, filepath.Join(filepath.Dir(path), "metrics-db.silences.json"))
+
+	restored, err := NewSilences(ctx, state)
+	require.NoError(t, err)
+	require.Len(t, restored.List(), 1)
+	assert.Equal(t, kept.ID, restored.List()[0].ID)
+	assert.True(t, restored.Muted(Alert{Metric: "PollCount"}))
+}
+
+func TestDispatcherSilences(t *testing.T) {
+	ctx := context.Background()
+	receiver := &testReceiver{}
+	d, clock := newTestDispatcher(receiver, nil, "")
+	silences, err := NewSilences(ctx, nil)
+	require.NoError(t, err)
+	silences.now = clock.now
+	d.silences = silences
+
+	silence, err := silences.Add(ctx, Silence{Metric: "PollCount", EndsAt: clock.t.Add(10 * time.Minute)})
+	require.NoError(t, err)
+
+	stuck := Alert{Name: "stuck", Metric: "PollCount", State: StateFiring}
+	d.Add([]Alert{stuck, {Name: "heap", Metric: "HeapAlloc", State: StateFiring}})
+	clock.advance(10 * time.Second)
+	d.Flush(ctx)
+	require.Len(t, receiver.notifications, 1)
+	assert.Equal(t, []string{"heap"}, alertNames(receiver.notifications[0]), "silenced alert is not sent")
+
+	// заглушенный алерт разрешился во время тишины — о нём так никто и не узнает
+	stuck.State = StateResolved
+	d.Add([]Alert{stuck})
+	clock.advance(10 * time.Second)
+	d.Flush(ctx)
+	assert.Len(t, receiver.notifications, 1)
+
+	// сработавший под тишиной алерт приходит только после её окончания
+	stuck.State = StateFiring
+	d.Add([]Alert{stuck})
+	clock.advance(10 * time.Second)
+	d.Flush(ctx)
+	assert.Len(t, receiver.notifications, 1)
+
+	require.NoError(t, silences.Delete(ctx, silence.ID))
+	d.Flush(ctx)
+	assert.Len(t, receiver.notifications, 1, "waits groupWait like any change")
+	clock.advance(10 * time.Second)
+	d.Flush(ctx)
+	require.Len(t, receiver.notifications, 2)
+	assert.Equal(t, []string{"heap", "stuck"}, alertNames(receiver.notifications[1]))
+}
@@ -0,0 +1,42 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// HashHeader — заголовок, в котором агент и сервер передают подпись тела.
+const HashHeader = "HashSHA256"
+
+func ComputeHash(data []byte, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func CheckHash(data []byte, key, hash string) bool {
+	expected, err := hex.DecodeString(hash)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(data)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// SignedData возвращает то, что подписывается в HTTP-запросе. Тело без
+// параметров в URL подписывается как есть; если тела нет или в URL есть query,
+// к телу добавляются метод и URI — иначе данные из пути и параметров можно подменить.
+func SignedData(method, requestURI string, body []byte) []byte {
+	if len(body) > 0 && !strings.Contains(requestURI, "?") {
+		return body
+	}
+	data := make([]byte, 0, len(method)+len(requestURI)+len(body)+2)
+	data = append(data, method...)
+	data = append(data, ' ')
+	data = append(data, requestURI...)
+	data = append(data, '\n')
+	return append(data, body...)
+}
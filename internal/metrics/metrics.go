@@ -1,21 +1,43 @@
 package metrics
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"encoding/json"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
 )
 
+// Хранилище разбито на шарды по имени метрики: писатели в разные шарды
+// не мешают друг другу, а снимок блокирует каждый шард только на время копирования.
+const shardCount = 32
+
+type shard struct {
+	mu         sync.RWMutex
+	gauges     map[string]float64
+	counters   map[string]int64
+	histograms map[string]*store.HistogramState
+	summaries  map[string]*store.SummaryState
+}
+
 type MemStorage struct {
-	gauges   map[string]float64
-	counters map[string]int64
+	shards [shardCount]*shard
 }
 
 func NewMemStorage() *MemStorage {
-	return &MemStorage{
-		gauges:   make(map[string]float64),
-		counters: make(map[string]int64),
+	s := &MemStorage{}
+	for i := range s.shards {
+		s.shards[i] = &shard{
+			gauges:     make(map[string]float64),
+			counters:   make(map[string]int64),
+			histograms: make(map[string]*store.HistogramState),
+			summaries:  make(map[string]*store.SummaryState),
+		}
 	}
+	return s
 }
 
 // type StorageInterface interface {
@@ -24,58 +46,292 @@ func NewMemStorage() *MemStorage {
 // 	GetAllMetrics() map[string]interface{}
 // }
 
-func (s *MemStorage) UpdateGauge(name string, value float64) {
-	s.gauges[name] = value
+func shardIndex(name string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32() % shardCount)
 }
 
-func (s *MemStorage) UpdateCounter(name string, value int64) int64 {
-	s.counters[name] += value
-	return s.counters[name]
+func (s *MemStorage) shardFor(name string) *shard {
+	return s.shards[shardIndex(name)]
 }
 
-func (s *MemStorage) GetAllMetrics() map[string]interface{} {
-	metrics := make(map[string]interface{})
-	gauges := make(map[string]float64)
-	counters := make(map[string]int64)
-	for k, v := range s.gauges {
-		gauges[k] = v
+func (s *MemStorage) UpdateGauge(ctx context.Context, name string, value float64) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	metrics["gauges"] = gauges
-	for k, v := range s.counters {
-		counters[k] = v
+	if err := models.ValidateValue(value); err != nil {
+		return fmt.Errorf("gauge '%s': %w", name, err)
 	}
-	metrics["counters"] = counters
-	return metrics
+	sh := s.shardFor(name)
+	sh.mu.Lock()
+	sh.gauges[name] = value
+	sh.mu.Unlock()
+	return nil
 }
 
-func (s *MemStorage) GetMetricsByTypeAndName(mName, mType string) ([]byte, error) {
-	var value interface{}
-	var found bool
+func (s *MemStorage) UpdateCounter(ctx context.Context, name string, value int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	sh := s.shardFor(name)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.counters[name] += value
+	return sh.counters[name], nil
+}
+
+func (s *MemStorage) UpdateBatch(ctx context.Context, metrics []models.Metrics) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// сначала проверяем всё, чтобы не применить пачку наполовину
+	for _, m := range metrics {
+		if err := m.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// берём все нужные шарды по возрастанию индекса, чтобы не словить дедлок
+	// с параллельной пачкой, и отпускаем только после применения всей пачки
+	indexes := make(map[int]struct{})
+	for _, m := range metrics {
+		indexes[shardIndex(m.SeriesID())] = struct{}{}
+	}
+	locked := make([]int, 0, len(indexes))
+	for i := range indexes {
+		locked = append(locked, i)
+	}
+	sort.Ints(locked)
+	for _, i := range locked {
+		s.shards[i].mu.Lock()
+	}
+	defer func() {
+		for _, i := range locked {
+			s.shards[i].mu.Unlock()
+		}
+	}()
+
+	// границы и квантили сверяются под блокировкой, до первой записи
+	for _, m := range metrics {
+		sh := s.shardFor(m.SeriesID())
+		var err error
+		switch m.MType {
+		case models.Histogram:
+			err = store.CheckHistogram(sh.histograms[m.SeriesID()], m)
+		case models.Summary:
+			err = store.CheckSummary(sh.summaries[m.SeriesID()], m)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, m := range metrics {
+		id := m.SeriesID()
+		sh := s.shardFor(id)
+		switch m.MType {
+		case models.Gauge:
+			sh.gauges[id] = *m.Value
+		case models.Counter:
+			sh.counters[id] += *m.Delta
+		case models.Histogram:
+			sh.histograms[id] = store.ObserveHistogram(sh.histograms[id], m)
+		case models.Summary:
+			sh.summaries[id] = store.ObserveSummary(sh.summaries[id], m)
+		}
+	}
+	return nil
+}
 
+// RestoreDistributions заменяет гистограммы и summary значениями из снимка.
+func (s *MemStorage) RestoreDistributions(ctx context.Context, histograms map[string]store.HistogramState, summaries map[string]store.SummaryState) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for id, h := range histograms {
+		if len(h.Counts) != len(h.Bounds)+1 {
+			return fmt.Errorf("histogram '%s': %w: counts do not match bounds", id, models.ErrInvalidValue)
+		}
+		h = h.Clone()
+		sh := s.shardFor(id)
+		sh.mu.Lock()
+		sh.histograms[id] = &h
+		sh.mu.Unlock()
+	}
+	for id, sum := range summaries {
+		if len(sum.Window) > store.SummaryWindow || sum.Next < 0 || sum.Next >= store.SummaryWindow {
+			return fmt.Errorf("summary '%s': %w: window is corrupted", id, models.ErrInvalidValue)
+		}
+		sum = sum.Clone()
+		sh := s.shardFor(id)
+		sh.mu.Lock()
+		sh.summaries[id] = &sum
+		sh.mu.Unlock()
+	}
+	return nil
+}
+
+func (s *MemStorage) DeleteMetric(ctx context.Context, mName, mType string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sh := s.shardFor(mName)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	var found bool
 	switch mType {
-	case "gauge":
-		value, found = s.gauges[mName]
-	case "counter":
-		value, found = s.counters[mName]
+	case models.Gauge:
+		if _, found = sh.gauges[mName]; found {
+			delete(sh.gauges, mName)
+		}
+	case models.Counter:
+		if _, found = sh.counters[mName]; found {
+			delete(sh.counters, mName)
+		}
+	case models.Histogram:
+		if _, found = sh.histograms[mName]; found {
+			delete(sh.histograms, mName)
+		}
+	case models.Summary:
+		if _, found = sh.summaries[mName]; found {
+			delete(sh.summaries, mName)
+		}
 	default:
-		return nil, errors.New("invalid metric type")
+		return models.ErrInvalidType
 	}
 
 	if !found {
-		return nil, fmt.Errorf("metric '%s' of type '%s' not found", mName, mType)
+		return fmt.Errorf("metric '%s' of type '%s' %w", mName, mType, store.ErrNotFound)
 	}
+	return nil
+}
 
-	// вдруг пригодиться 
-	// response := struct {
-    //     Value interface{} `json:"value"`
-    // }{
-    //     Value: value,
-    // }
+func (s *MemStorage) ResetCounter(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	jsonData, err := json.Marshal(value)
-		if err != nil {
-			return nil,fmt.Errorf("failed to marshal metric: %w", err)
+	sh := s.shardFor(name)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if _, ok := sh.counters[name]; !ok {
+		return fmt.Errorf("metric '%s' of type '%s' %w", name, models.Counter, store.ErrNotFound)
+	}
+	sh.counters[name] = 0
+	return nil
+}
+
+// DeleteByPrefix проходит шарды по очереди, как и GetAllMetrics:
+// метрика, записанная во время удаления, может и уцелеть.
+func (s *MemStorage) DeleteByPrefix(ctx context.Context, prefix string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
 	}
 
-	return jsonData, nil
+	deleted := 0
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		deleted += deletePrefix(sh.gauges, prefix)
+		deleted += deletePrefix(sh.counters, prefix)
+		deleted += deletePrefix(sh.histograms, prefix)
+		deleted += deletePrefix(sh.summaries, prefix)
+		sh.mu.Unlock()
+	}
+	return deleted, nil
+}
+
+func deletePrefix[V any](m map[string]V, prefix string) int {
+	deleted := 0
+	for name := range m {
+		if strings.HasPrefix(name, prefix) {
+			delete(m, name)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// Ping у памяти всегда успешен.
+func (s *MemStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemStorage) GetAllMetrics(ctx context.Context) (store.Snapshot, error) {
+	if err := ctx.Err(); err != nil {
+		return store.Snapshot{}, err
+	}
+	snapshot := store.Snapshot{
+		Gauges:     make(map[string]float64),
+		Counters:   make(map[string]int64),
+		Histograms: make(map[string]store.HistogramState),
+		Summaries:  make(map[string]store.SummaryState),
+	}
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for k, v := range sh.gauges {
+			snapshot.Gauges[k] = v
+		}
+		for k, v := range sh.counters {
+			snapshot.Counters[k] = v
+		}
+		for k, v := range sh.histograms {
+			snapshot.Histograms[k] = v.Clone()
+		}
+		for k, v := range sh.summaries {
+			snapshot.Summaries[k] = v.Clone()
+		}
+		sh.mu.RUnlock()
+	}
+	return snapshot, nil
+}
+
+func (s *MemStorage) GetMetricsByTypeAndName(ctx context.Context, mName, mType string) (models.Metrics, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Metrics{}, err
+	}
+
+	metric := models.Metrics{MType: mType}
+	metric.ID, metric.Labels = models.ParseSeriesID(mName)
+	var found bool
+
+	sh := s.shardFor(mName)
+	sh.mu.RLock()
+	switch mType {
+	case models.Gauge:
+		var value float64
+		if value, found = sh.gauges[mName]; found {
+			metric.Value = &value
+		}
+	case models.Counter:
+		var delta int64
+		if delta, found = sh.counters[mName]; found {
+			metric.Delta = &delta
+		}
+	case models.Histogram:
+		var h *store.HistogramState
+		if h, found = sh.histograms[mName]; found {
+			data := h.Data()
+			metric.Histogram = &data
+		}
+	case models.Summary:
+		var sum *store.SummaryState
+		if sum, found = sh.summaries[mName]; found {
+			data := sum.Data()
+			metric.Summary = &data
+		}
+	default:
+		sh.mu.RUnlock()
+		return models.Metrics{}, models.ErrInvalidType
+	}
+	sh.mu.RUnlock()
+
+	if !found {
+		return models.Metrics{}, fmt.Errorf("metric '%s' of type '%s' %w", mName, mType, store.ErrNotFound)
+	}
+	return metric, nil
 }
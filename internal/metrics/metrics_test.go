@@ -1,17 +1,21 @@
 package metrics
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
+	"math"
+	"sync"
 	"testing"
-	"strconv"
-	"unsafe"
 	"github.com/stretchr/testify/assert"
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
 )
 
 func TestGetMetric(t *testing.T) {
+	ctx := context.Background()
 	storage := NewMemStorage()
-	storage.UpdateGauge("temperature", 36.6)
-	storage.UpdateCounter("requests", 42)
+	storage.UpdateGauge(ctx, "temperature", 36.6)
+	storage.UpdateCounter(ctx, "requests", 42)
 
 	tests := []struct {
 		name        string
@@ -51,7 +55,7 @@ func TestGetMetric(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			jsonData, err := storage.GetMetricsByTypeAndName( tt.metricName,tt.metricType)
+			metric, err := storage.GetMetricsByTypeAndName(context.Background(), tt.metricName,tt.metricType)
 			
 			if tt.wantErr {
 				if err == nil {
@@ -67,11 +71,14 @@ func TestGetMetric(t *testing.T) {
 				t.Fatalf("unexpected error: %v", err)
 			}
 
-
-			err = json.Unmarshal(jsonData, &tt.wantValue)
-			
-			assert.NoError(t, err, "Unmarshal should not fail")
-			assert.Equal(t, tt.wantValue, bytesToFloat64Fast(jsonData), "Values should be equal")
+			switch want := tt.wantValue.(type) {
+			case float64:
+				assert.NotNil(t, metric.Value, "gauge value should be set")
+				assert.Equal(t, want, *metric.Value, "Values should be equal")
+			case int64:
+				assert.NotNil(t, metric.Delta, "counter delta should be set")
+				assert.Equal(t, want, *metric.Delta, "Values should be equal")
+			}
 			
 		})
 	}
@@ -81,7 +88,165 @@ func contains(s, substr string) bool {
 	return len(s) >= len(substr) && s[:len(substr)] == substr
 }
 
-func bytesToFloat64Fast(b []byte) (float64) {
-	value,_:=strconv.ParseFloat(unsafe.String(unsafe.SliceData(b), len(b)), 64)
-    return value
-}
\ No newline at end of file
+func TestUpdateBatch(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemStorage()
+	storage.UpdateCounter(ctx, "PollCount", 1)
+
+	gauge := 3.5
+	delta := int64(2)
+	err := storage.UpdateBatch(ctx, []models.Metrics{
+		{ID: "Alloc", MType: models.Gauge, Value: &gauge},
+		{ID: "PollCount", MType: models.Counter, Delta: &delta},
+		{ID: "PollCount", MType: models.Counter, Delta: &delta},
+	})
+	assert.NoError(t, err)
+	all, err := storage.GetAllMetrics(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3.5, all.Gauges["Alloc"])
+	assert.Equal(t, int64(5), all.Counters["PollCount"])
+
+	err = storage.UpdateBatch(ctx, []models.Metrics{
+		{ID: "Other", MType: models.Gauge, Value: &gauge},
+		{ID: "PollCount", MType: models.Counter},
+	})
+	assert.ErrorIs(t, err, models.ErrMissingValue)
+	all, err = storage.GetAllMetrics(ctx)
+	assert.NoError(t, err)
+	_, found := all.Gauges["Other"]
+	assert.False(t, found, "batch must not be applied partially")
+	assert.Equal(t, int64(5), all.Counters["PollCount"])
+
+	nan := math.NaN()
+	err = storage.UpdateBatch(ctx, []models.Metrics{{ID: "Other", MType: models.Gauge, Value: &nan}})
+	assert.ErrorIs(t, err, models.ErrInvalidValue)
+	assert.ErrorIs(t, storage.UpdateGauge(ctx, "Other", math.Inf(1)), models.ErrInvalidValue)
+	all, err = storage.GetAllMetrics(ctx)
+	assert.NoError(t, err)
+	_, found = all.Gauges["Other"]
+	assert.False(t, found, "non-finite gauges are not stored")
+}
+
+// Запускать с -race: go test -race ./internal/metrics
+func TestUpdateBatchDistributions(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemStorage()
+
+	for _, v := range []float64{0.2, 0.7, 2} {
+		assert.NoError(t, storage.UpdateBatch(ctx, []models.Metrics{
+			{ID: "latency", MType: models.Histogram, Value: &v, Buckets: []float64{0.5, 1}},
+			{ID: "latency", MType: models.Summary, Value: &v},
+		}))
+	}
+
+	histogram, err := storage.GetMetricsByTypeAndName(ctx, "latency", models.Histogram)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), histogram.Histogram.Count)
+	assert.Equal(t, []models.Bucket{{UpperBound: 0.5, Count: 1}, {UpperBound: 1, Count: 2}}, histogram.Histogram.Buckets)
+
+	summary, err := storage.GetMetricsByTypeAndName(ctx, "latency", models.Summary)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), summary.Summary.Count)
+
+	v := 0.1
+	err = storage.UpdateBatch(ctx, []models.Metrics{
+		{ID: "other", MType: models.Histogram, Value: &v},
+		{ID: "latency", MType: models.Histogram, Value: &v, Buckets: []float64{1}},
+	})
+	assert.ErrorIs(t, err, models.ErrInvalidValue)
+	_, err = storage.GetMetricsByTypeAndName(ctx, "other", models.Histogram)
+	assert.ErrorIs(t, err, store.ErrNotFound, "batch must not be applied partially")
+
+	nan := math.NaN()
+	err = storage.UpdateBatch(ctx, []models.Metrics{{ID: "latency", MType: models.Summary, Value: &nan}})
+	assert.ErrorIs(t, err, models.ErrInvalidValue)
+}
+
+func TestDeleteAndReset(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemStorage()
+	storage.UpdateGauge(ctx, "Alloc", 1.5)
+	storage.UpdateGauge(ctx, "old.Alloc", 2)
+	storage.UpdateCounter(ctx, "PollCount", 5)
+	storage.UpdateCounter(ctx, "old.PollCount", 7)
+
+	assert.NoError(t, storage.ResetCounter(ctx, "PollCount"))
+	metric, err := storage.GetMetricsByTypeAndName(ctx, "PollCount", models.Counter)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), *metric.Delta)
+	assert.ErrorIs(t, storage.ResetCounter(ctx, "Missing"), store.ErrNotFound)
+
+	assert.NoError(t, storage.DeleteMetric(ctx, "Alloc", models.Gauge))
+	assert.ErrorIs(t, storage.DeleteMetric(ctx, "Alloc", models.Gauge), store.ErrNotFound)
+	assert.ErrorIs(t, storage.DeleteMetric(ctx, "PollCount", models.Gauge), store.ErrNotFound)
+	assert.ErrorIs(t, storage.DeleteMetric(ctx, "PollCount", "invalid"), models.ErrInvalidType)
+
+	deleted, err := storage.DeleteByPrefix(ctx, "old.")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	all, err := storage.GetAllMetrics(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, all.Gauges)
+	assert.Equal(t, map[string]int64{"PollCount": 0}, all.Counters)
+}
+
+func TestMemStorageConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemStorage()
+
+	const (
+		workers    = 16
+		iterations = 1000
+	)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				storage.UpdateCounter(ctx, "PollCount", 1)
+				storage.UpdateGauge(ctx, fmt.Sprintf("Gauge%d", i%50), float64(i))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			delta := int64(1)
+			for i := 0; i < iterations/10; i++ {
+				storage.UpdateBatch(ctx, []models.Metrics{
+					{ID: "BatchCount", MType: models.Counter, Delta: &delta},
+					{ID: "PollCount", MType: models.Counter, Delta: &delta},
+				})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations/10; i++ {
+				storage.GetAllMetrics(ctx)
+				storage.GetMetricsByTypeAndName(ctx, "PollCount", models.Counter)
+			}
+		}()
+	}
+	wg.Wait()
+
+	all, err := storage.GetAllMetrics(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(workers*iterations+workers*iterations/10), all.Counters["PollCount"])
+	assert.Equal(t, int64(workers*iterations/10), all.Counters["BatchCount"])
+}
+
+func TestMemStorageCancelledContext(t *testing.T) {
+	storage := NewMemStorage()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, storage.UpdateGauge(ctx, "Alloc", 1), context.Canceled)
+	_, err := storage.UpdateCounter(ctx, "PollCount", 1)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	all, err := storage.GetAllMetrics(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, all.Gauges)
+	assert.Empty(t, all.Counters)
+}
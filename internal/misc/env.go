@@ -1 +1,141 @@
 package misc
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	"ypMetrics/internal/helper"
+
+	"github.com/spf13/viper"
+)
+
+type ServerConfig struct {
+	Address         string
+	Key             string
+	StoreInterval   time.Duration
+	FileStoragePath string
+	Restore         bool
+	DatabaseDSN     string
+	StatsDAddress   string
+	GraphiteAddress string
+	GRPCAddress     string
+	// HistoryRetention — сколько хранить историю значений, 0 отключает историю
+	HistoryRetention time.Duration
+	// AlertRulesPath — файл с правилами алертов, пустой отключает алертинг
+	AlertRulesPath string
+	AlertInterval  time.Duration
+	// AlertWebhooks и SMTPTo — списки через запятую в флагах и переменных окружения
+	AlertWebhooks       []string
+	AlertGroupBy        []string
+	AlertGroupWait      time.Duration
+	AlertRepeatInterval time.Duration
+	AlertDeadLetterPath string
+	SMTPAddress         string
+	SMTPFrom            string
+	SMTPTo              []string
+	SMTPUsername        string
+	SMTPPassword        string
+}
+
+// LoadServerConfig читает флаги и переменные окружения сервера.
+// Переменные окружения имеют приоритет над флагами.
+func LoadServerConfig() ServerConfig {
+	viper.AutomaticEnv()
+
+	var (
+		cfg              ServerConfig
+		storeInterval    int
+		historyRetention int
+		alertInterval    int
+		webhooks         string
+		groupBy          string
+		groupWait        int
+		repeatInterval   int
+		smtpTo           string
+	)
+
+	flag.StringVar(&cfg.Address, "a", "localhost:8080", "server adress")
+	flag.StringVar(&cfg.Key, "k", "", "key for HMAC-SHA256 signing; modifying requests, including /silences, must carry HashSHA256, except /write and /v1/metrics")
+	flag.IntVar(&storeInterval, "i", 300, "store interval in seconds, 0 means synchronous write")
+	flag.StringVar(&cfg.FileStoragePath, "f", "metrics-db.json", "file storage path")
+	flag.BoolVar(&cfg.Restore, "r", true, "restore metrics from file on start")
+	flag.StringVar(&cfg.DatabaseDSN, "d", "", "database DSN (postgres:// or sqlite file)")
+	flag.StringVar(&cfg.StatsDAddress, "s", "", "UDP address for StatsD listener, empty to disable")
+	flag.StringVar(&cfg.GraphiteAddress, "g", "", "TCP address for Graphite plaintext listener, empty to disable")
+	flag.StringVar(&cfg.GRPCAddress, "grpc", "", "address for gRPC server, empty to disable")
+	flag.IntVar(&historyRetention, "history", 3600, "metric history retention in seconds, 0 disables history")
+	flag.StringVar(&cfg.AlertRulesPath, "rules", "", "alert rules file, empty to disable alerting")
+	flag.IntVar(&alertInterval, "alert-interval", 15, "alert rules evaluation interval in seconds")
+	flag.StringVar(&webhooks, "webhook", "", "comma-separated webhook URLs for alert notifications")
+	flag.StringVar(&groupBy, "alert-group-by", "", "comma-separated labels to group alert notifications by")
+	flag.IntVar(&groupWait, "alert-group-wait", 10, "seconds to collect alerts into one notification")
+	flag.IntVar(&repeatInterval, "alert-repeat", 14400, "seconds before repeating a notification for still firing alerts")
+	flag.StringVar(&cfg.AlertDeadLetterPath, "dead-letter", "alerts-dead-letter.jsonl", "file for undelivered alert notifications, empty to only log them")
+	flag.StringVar(&cfg.SMTPAddress, "smtp", "", "SMTP server host:port for alert emails, empty to disable")
+	flag.StringVar(&cfg.SMTPFrom, "smtp-from", "", "sender address for alert emails")
+	flag.StringVar(&smtpTo, "smtp-to", "", "comma-separated recipients for alert emails")
+	flag.StringVar(&cfg.SMTPUsername, "smtp-user", "", "SMTP username, empty to send without auth")
+	flag.StringVar(&cfg.SMTPPassword, "smtp-password", "", "SMTP password")
+
+	flag.Parse()
+
+	helper.AssignIfNotEmpty(&cfg.Address, viper.GetString("ADDRESS"))
+	helper.AssignIfNotEmpty(&cfg.Key, viper.GetString("KEY"))
+	helper.AssignIfNotEmpty(&cfg.FileStoragePath, viper.GetString("FILE_STORAGE_PATH"))
+	helper.AssignIfNotEmpty(&cfg.DatabaseDSN, viper.GetString("DATABASE_DSN"))
+	helper.AssignIfNotEmpty(&cfg.StatsDAddress, viper.GetString("STATSD_ADDRESS"))
+	helper.AssignIfNotEmpty(&cfg.GraphiteAddress, viper.GetString("GRAPHITE_ADDRESS"))
+	helper.AssignIfNotEmpty(&cfg.GRPCAddress, viper.GetString("GRPC_ADDRESS"))
+	helper.AssignIfNotEmpty(&cfg.AlertRulesPath, viper.GetString("ALERT_RULES"))
+	if viper.GetInt("ALERT_INTERVAL") > 0 {
+		alertInterval = viper.GetInt("ALERT_INTERVAL")
+	}
+	helper.AssignIfNotEmpty(&webhooks, viper.GetString("ALERT_WEBHOOKS"))
+	helper.AssignIfNotEmpty(&groupBy, viper.GetString("ALERT_GROUP_BY"))
+	helper.AssignIfNotEmpty(&cfg.SMTPAddress, viper.GetString("SMTP_ADDRESS"))
+	helper.AssignIfNotEmpty(&cfg.SMTPFrom, viper.GetString("SMTP_FROM"))
+	helper.AssignIfNotEmpty(&smtpTo, viper.GetString("SMTP_TO"))
+	helper.AssignIfNotEmpty(&cfg.SMTPUsername, viper.GetString("SMTP_USERNAME"))
+	helper.AssignIfNotEmpty(&cfg.SMTPPassword, viper.GetString("SMTP_PASSWORD"))
+	if viper.IsSet("ALERT_GROUP_WAIT") {
+		groupWait = viper.GetInt("ALERT_GROUP_WAIT")
+	}
+	if viper.GetInt("ALERT_REPEAT_INTERVAL") > 0 {
+		repeatInterval = viper.GetInt("ALERT_REPEAT_INTERVAL")
+	}
+	if viper.IsSet("ALERT_DEAD_LETTER") {
+		cfg.AlertDeadLetterPath = viper.GetString("ALERT_DEAD_LETTER")
+	}
+	// 0 и false — осмысленные значения, поэтому смотрим на факт наличия переменной
+	if viper.IsSet("STORE_INTERVAL") {
+		storeInterval = viper.GetInt("STORE_INTERVAL")
+	}
+	if viper.IsSet("RESTORE") {
+		cfg.Restore = viper.GetBool("RESTORE")
+	}
+	if viper.IsSet("HISTORY_RETENTION") {
+		historyRetention = viper.GetInt("HISTORY_RETENTION")
+	}
+
+	cfg.StoreInterval = time.Duration(storeInterval) * time.Second
+	cfg.HistoryRetention = time.Duration(historyRetention) * time.Second
+	cfg.AlertInterval = time.Duration(alertInterval) * time.Second
+	cfg.AlertWebhooks = splitList(webhooks)
+	cfg.AlertGroupBy = splitList(groupBy)
+	cfg.AlertGroupWait = time.Duration(groupWait) * time.Second
+	cfg.AlertRepeatInterval = time.Duration(repeatInterval) * time.Second
+	cfg.SMTPTo = splitList(smtpTo)
+	return cfg
+}
+
+// splitList разбирает список через запятую, пропуская пустые элементы.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,98 @@
+package proto
+
+import "ypMetrics/models"
+
+func TypeFromModel(mType string) Metric_MType {
+	switch mType {
+	case models.Gauge:
+		return Metric_GAUGE
+	case models.Counter:
+		return Metric_COUNTER
+	case models.Histogram:
+		return Metric_HISTOGRAM
+	case models.Summary:
+		return Metric_SUMMARY
+	default:
+		return Metric_UNSPECIFIED
+	}
+}
+
+func TypeToModel(mType Metric_MType) string {
+	switch mType {
+	case Metric_GAUGE:
+		return models.Gauge
+	case Metric_COUNTER:
+		return models.Counter
+	case Metric_HISTOGRAM:
+		return models.Histogram
+	case Metric_SUMMARY:
+		return models.Summary
+	default:
+		return ""
+	}
+}
+
+func FromModel(m models.Metrics) *Metric {
+	metric := &Metric{
+		Id:        m.ID,
+		Type:      TypeFromModel(m.MType),
+		Labels:    m.Labels,
+		Buckets:   m.Buckets,
+		Quantiles: m.Quantiles,
+	}
+	if m.Delta != nil {
+		metric.Delta = *m.Delta
+	}
+	if m.Value != nil {
+		metric.Value = *m.Value
+	}
+	if m.Histogram != nil {
+		metric.Histogram = HistogramFromModel(*m.Histogram)
+	}
+	if m.Summary != nil {
+		metric.Summary = SummaryFromModel(*m.Summary)
+	}
+	return metric
+}
+
+func HistogramFromModel(h models.HistogramData) *HistogramData {
+	data := &HistogramData{Count: h.Count, Sum: h.Sum}
+	for _, b := range h.Buckets {
+		data.Buckets = append(data.Buckets, &HistogramData_Bucket{UpperBound: b.UpperBound, Count: b.Count})
+	}
+	return data
+}
+
+func SummaryFromModel(s models.SummaryData) *SummaryData {
+	data := &SummaryData{Count: s.Count, Sum: s.Sum}
+	for _, q := range s.Quantiles {
+		data.Quantiles = append(data.Quantiles, &SummaryData_Quantile{Quantile: q.Quantile, Value: q.Value})
+	}
+	return data
+}
+
+// ToModel заполняет только те поля, которые соответствуют типу метрики.
+// Неизвестный тип остаётся пустым, и хранилище отвергнет метрику с ErrInvalidType.
+func ToModel(m *Metric) models.Metrics {
+	metric := models.Metrics{ID: m.GetId(), MType: TypeToModel(m.GetType())}
+	if len(m.GetLabels()) > 0 {
+		metric.Labels = m.GetLabels()
+	}
+	switch m.GetType() {
+	case Metric_GAUGE:
+		value := m.GetValue()
+		metric.Value = &value
+	case Metric_COUNTER:
+		delta := m.GetDelta()
+		metric.Delta = &delta
+	case Metric_HISTOGRAM:
+		value := m.GetValue()
+		metric.Value = &value
+		metric.Buckets = m.GetBuckets()
+	case Metric_SUMMARY:
+		value := m.GetValue()
+		metric.Value = &value
+		metric.Quantiles = m.GetQuantiles()
+	}
+	return metric
+}
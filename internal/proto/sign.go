@@ -0,0 +1,28 @@
+package proto
+
+import (
+	"ypMetrics/internal/helper"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// HashMetadataKey — ключ метаданных gRPC с подписью запроса (аналог заголовка HashSHA256).
+const HashMetadataKey = "hashsha256"
+
+// SignMessage считает подпись детерминированно сериализованного сообщения.
+func SignMessage(msg proto.Message, key string) (string, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	return helper.ComputeHash(data, key), nil
+}
+
+// CheckMessage проверяет подпись; пустое сообщение подписывать нечем, как и GET в HTTP.
+func CheckMessage(msg proto.Message, key, hash string) (bool, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return false, err
+	}
+	return len(data) == 0 || helper.CheckHash(data, key, hash), nil
+}
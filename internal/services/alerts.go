@@ -0,0 +1,43 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+
+	"ypMetrics/internal/alerts"
+)
+
+// alertView — алерт в ответе /alerts с отметкой о действующей тишине.
+type alertView struct {
+	alerts.Alert
+	Silenced bool `json:"silenced"`
+}
+
+// alertsHandler отдаёт алерты: по умолчанию активные (pending и firing),
+// ?state= выбирает одно состояние, в том числе resolved, ?state=all — все.
+func (h *Handler) alertsHandler(w http.ResponseWriter, r *http.Request) {
+	if h.alerts == nil {
+		http.Error(w, "Alerting is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	state := alerts.State(r.URL.Query().Get("state"))
+	switch state {
+	case "", "all", alerts.StatePending, alerts.StateFiring, alerts.StateResolved:
+	default:
+		http.Error(w, fmt.Sprintf("Invalid state '%s'", state), http.StatusBadRequest)
+		return
+	}
+
+	result := make([]alertView, 0)
+	for _, alert := range h.alerts.Alerts() {
+		switch {
+		case state == "all",
+			state == "" && alert.State != alerts.StateResolved,
+			alert.State == state:
+			silenced := h.silences != nil && h.silences.Muted(alert)
+			result = append(result, alertView{Alert: alert, Silenced: silenced})
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
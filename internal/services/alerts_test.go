@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ypMetrics/internal/alerts"
+	"ypMetrics/internal/metrics"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertsHandler(t *testing.T) {
+	ctx := context.Background()
+	storage := metrics.NewMemStorage()
+	rules, err := alerts.ParseRules(strings.NewReader("high: gauge Alloc > 10\nlow: gauge Alloc < 5 for 1h\nresolved: gauge Free > 1\n"))
+	require.NoError(t, err)
+	engine := alerts.NewEngine(storage, rules)
+
+	require.NoError(t, storage.UpdateGauge(ctx, "Alloc", 1))
+	require.NoError(t, storage.UpdateGauge(ctx, "Free", 2))
+	engine.Evaluate(ctx)
+	require.NoError(t, storage.UpdateGauge(ctx, "Alloc", 20))
+	require.NoError(t, storage.UpdateGauge(ctx, "Free", 0))
+	engine.Evaluate(ctx)
+
+	silences, err := alerts.NewSilences(ctx, nil)
+	require.NoError(t, err)
+	_, err = silences.Add(ctx, alerts.Silence{Metric: "Alloc", EndsAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	handler := &Handler{storage: storage, alerts: engine, silences: silences}
+
+	tests := []struct {
+		name       string
+		query      string
+		statusCode int
+		want       []string
+	}{
+		{name: "active by default", statusCode: http.StatusOK, want: []string{"high"}},
+		{name: "resolved", query: "?state=resolved", statusCode: http.StatusOK, want: []string{"resolved"}},
+		{name: "all", query: "?state=all", statusCode: http.StatusOK, want: []string{"high", "resolved"}},
+		{name: "pending", query: "?state=pending", statusCode: http.StatusOK, want: []string{}},
+		{name: "invalid state", query: "?state=inactive", statusCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := httptest.NewRecorder()
+			handler.alertsHandler(record, httptest.NewRequest(http.MethodGet, "/alerts"+tt.query, nil))
+
+			require.Equal(t, tt.statusCode, record.Code, record.Body.String())
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+			var got []alertView
+			require.NoError(t, json.Unmarshal(record.Body.Bytes(), &got))
+			names := make([]string, 0, len(got))
+			for _, alert := range got {
+				names = append(names, alert.Name)
+				assert.Equal(t, alert.Metric == "Alloc", alert.Silenced, alert.Name)
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
+
+func TestAlertsHandlerDisabled(t *testing.T) {
+	handler := NewHandler(metrics.NewMemStorage())
+	record := httptest.NewRecorder()
+
+	handler.alertsHandler(record, httptest.NewRequest(http.MethodGet, "/alerts", nil))
+
+	assert.Equal(t, http.StatusNotImplemented, record.Code)
+}
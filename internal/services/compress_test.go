@@ -0,0 +1,80 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+	echo := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}))
+
+	payload := `{"id":"Alloc","type":"gauge","value":1.5}`
+
+	t.Run("decompress request", func(t *testing.T) {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(payload))
+		gz.Close()
+
+		request := httptest.NewRequest(http.MethodPost, "/update/", &buf)
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Content-Encoding", "gzip")
+		record := httptest.NewRecorder()
+
+		echo.ServeHTTP(record, request)
+
+		assert.Equal(t, http.StatusOK, record.Code)
+		assert.Empty(t, record.Header().Get("Content-Encoding"))
+		assert.Equal(t, payload, record.Body.String())
+	})
+
+	t.Run("compress json response", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewBufferString(payload))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Accept-Encoding", "gzip")
+		record := httptest.NewRecorder()
+
+		echo.ServeHTTP(record, request)
+
+		assert.Equal(t, "gzip", record.Header().Get("Content-Encoding"))
+		gz, err := gzip.NewReader(record.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		assert.Equal(t, payload, string(body))
+	})
+
+	t.Run("skip plain text", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewBufferString("ok"))
+		request.Header.Set("Content-Type", "text/plain")
+		request.Header.Set("Accept-Encoding", "gzip")
+		record := httptest.NewRecorder()
+
+		echo.ServeHTTP(record, request)
+
+		assert.Empty(t, record.Header().Get("Content-Encoding"))
+		assert.Equal(t, "ok", record.Body.String())
+	})
+
+	t.Run("broken gzip body", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewBufferString(payload))
+		request.Header.Set("Content-Encoding", "gzip")
+		record := httptest.NewRecorder()
+
+		echo.ServeHTTP(record, request)
+
+		assert.Equal(t, http.StatusBadRequest, record.Code)
+	})
+}
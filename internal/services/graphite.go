@@ -0,0 +1,106 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+)
+
+// ListenGraphite принимает plaintext-протокол Graphite ("path.to.metric value timestamp")
+// по TCP и сохраняет каждую строку как gauge. Работает, пока не отменён ctx.
+func ListenGraphite(ctx context.Context, addr string, storage store.Storage) (net.Addr, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("graphite listen error: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+					return
+				}
+				log.Printf("Error accepting graphite connection: %v", err)
+				continue
+			}
+			go serveGraphiteConn(ctx, conn, storage)
+		}
+	}()
+
+	return listener.Addr(), nil
+}
+
+func serveGraphiteConn(ctx context.Context, conn net.Conn, storage store.Storage) {
+	done := make(chan struct{})
+	defer close(done)
+	defer conn.Close()
+
+	// закрываем соединение при остановке сервера, чтобы разбудить Scan
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		name, value, err := parseGraphiteLine(line)
+		if err != nil {
+			log.Printf("Error parsing graphite line %q: %v", line, err)
+			continue
+		}
+		if err := storage.UpdateGauge(ctx, models.SeriesID(name, nil), value); err != nil {
+			log.Printf("Error storing graphite metric %s: %v", name, err)
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("Error reading graphite connection %s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// parseGraphiteLine разбирает "path value [timestamp]". Метка времени проверяется,
+// но не используется: сервер хранит только последнее значение.
+func parseGraphiteLine(line string) (string, float64, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return "", 0, errors.New("expected path, value and timestamp")
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid value %q", fields[1])
+	}
+	// NaN и Inf не сериализуются в JSON
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return "", 0, fmt.Errorf("non-finite value %q", fields[1])
+	}
+
+	if len(fields) == 3 {
+		if _, err := strconv.ParseFloat(fields[2], 64); err != nil {
+			return "", 0, fmt.Errorf("invalid timestamp %q", fields[2])
+		}
+	}
+
+	return fields[0], value, nil
+}
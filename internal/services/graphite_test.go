@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"ypMetrics/internal/metrics"
+	"ypMetrics/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGraphiteLine(t *testing.T) {
+	tests := []struct {
+		line      string
+		wantName  string
+		wantValue float64
+		wantErr   bool
+	}{
+		{line: "servers.web1.load 0.75 1700000000", wantName: "servers.web1.load", wantValue: 0.75},
+		{line: "backup.duration_seconds  42", wantName: "backup.duration_seconds", wantValue: 42},
+		{line: "servers.web1.load", wantErr: true},
+		{line: "servers.web1.load high 1700000000", wantErr: true},
+		{line: "servers.web1.load 1 now", wantErr: true},
+		{line: "servers.web1.load NaN 1700000000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			name, value, err := parseGraphiteLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantName, name)
+			assert.Equal(t, tt.wantValue, value)
+		})
+	}
+}
+
+func TestListenGraphite(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storage := metrics.NewMemStorage()
+
+	addr, err := ListenGraphite(ctx, "127.0.0.1:0", storage)
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", addr.String())
+	require.NoError(t, err)
+	fmt.Fprintf(conn, "cron.backup.size 1024 %d\ngarbage\ncron.backup.ok 1 %d\n", time.Now().Unix(), time.Now().Unix())
+	conn.Close()
+
+	assert.Eventually(t, func() bool {
+		all, err := storage.GetAllMetrics(ctx)
+		return err == nil && all.Gauges["cron.backup.size"] == 1024 && all.Gauges["cron.backup.ok"] == 1
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		_, err := net.Dial("tcp", addr.String())
+		return err != nil
+	}, time.Second, 10*time.Millisecond, "listener must stop with the context")
+}
+
+func TestServeGraphiteConnEscapesName(t *testing.T) {
+	ctx := context.Background()
+	storage := metrics.NewMemStorage()
+	labeled := models.SeriesID("Alloc", models.Labels{"host": "a"})
+	require.NoError(t, storage.UpdateGauge(ctx, labeled, 1))
+
+	client, server := net.Pipe()
+	go func() {
+		fmt.Fprintf(client, "Alloc,host=a 5\n")
+		client.Close()
+	}()
+	serveGraphiteConn(ctx, server, storage)
+
+	m, err := storage.GetMetricsByTypeAndName(ctx, labeled, models.Gauge)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, *m.Value, "name with a comma must not overwrite the labeled series")
+	m, err = storage.GetMetricsByTypeAndName(ctx, models.SeriesID("Alloc,host=a", nil), models.Gauge)
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, *m.Value)
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+
+	pb "ypMetrics/internal/proto"
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type MetricsGRPCServer struct {
+	pb.UnimplementedMetricsServer
+	storage store.Storage
+}
+
+func NewGRPCServer(storage store.Storage, key string) *grpc.Server {
+	var opts []grpc.ServerOption
+	if key != "" {
+		opts = append(opts, grpc.UnaryInterceptor(hashInterceptor(key)))
+	}
+	server := grpc.NewServer(opts...)
+	pb.RegisterMetricsServer(server, &MetricsGRPCServer{storage: storage})
+	return server
+}
+
+// ListenGRPC запускает gRPC-сервер на addr и останавливает его вместе с ctx.
+func ListenGRPC(ctx context.Context, addr string, storage store.Storage, key string) (net.Addr, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := NewGRPCServer(storage, key)
+	go server.Serve(listener)
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	return listener.Addr(), nil
+}
+
+func (s *MetricsGRPCServer) UpdateMetrics(ctx context.Context, req *pb.UpdateMetricsRequest) (*pb.UpdateMetricsResponse, error) {
+	if len(req.GetMetrics()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "empty metrics batch")
+	}
+
+	metrics := make([]models.Metrics, 0, len(req.GetMetrics()))
+	for _, m := range req.GetMetrics() {
+		metrics = append(metrics, pb.ToModel(m))
+	}
+
+	if err := s.storage.UpdateBatch(ctx, metrics); err != nil {
+		return nil, grpcStorageError(err)
+	}
+	return &pb.UpdateMetricsResponse{}, nil
+}
+
+func (s *MetricsGRPCServer) GetMetric(ctx context.Context, req *pb.GetMetricRequest) (*pb.GetMetricResponse, error) {
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "metric id is required")
+	}
+
+	labels := models.Labels(req.GetLabels())
+	if err := labels.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	metric, err := s.storage.GetMetricsByTypeAndName(ctx, models.SeriesID(req.GetId(), labels), pb.TypeToModel(req.GetType()))
+	if err != nil {
+		return nil, grpcStorageError(err)
+	}
+	return &pb.GetMetricResponse{Metric: pb.FromModel(metric)}, nil
+}
+
+func (s *MetricsGRPCServer) ListMetrics(ctx context.Context, req *pb.ListMetricsRequest) (*pb.ListMetricsResponse, error) {
+	snapshot, err := s.storage.GetAllMetrics(ctx)
+	if err != nil {
+		return nil, grpcStorageError(err)
+	}
+
+	response := &pb.ListMetricsResponse{}
+	for id, value := range snapshot.Gauges {
+		name, labels := models.ParseSeriesID(id)
+		response.Metrics = append(response.Metrics, &pb.Metric{Id: name, Type: pb.Metric_GAUGE, Value: value, Labels: labels})
+	}
+	for id, delta := range snapshot.Counters {
+		name, labels := models.ParseSeriesID(id)
+		response.Metrics = append(response.Metrics, &pb.Metric{Id: name, Type: pb.Metric_COUNTER, Delta: delta, Labels: labels})
+	}
+	for id, state := range snapshot.Histograms {
+		name, labels := models.ParseSeriesID(id)
+		response.Metrics = append(response.Metrics, &pb.Metric{Id: name, Type: pb.Metric_HISTOGRAM, Histogram: pb.HistogramFromModel(state.Data()), Labels: labels})
+	}
+	for id, state := range snapshot.Summaries {
+		name, labels := models.ParseSeriesID(id)
+		response.Metrics = append(response.Metrics, &pb.Metric{Id: name, Type: pb.Metric_SUMMARY, Summary: pb.SummaryFromModel(state.Data()), Labels: labels})
+	}
+	sort.Slice(response.Metrics, func(i, j int) bool {
+		a, b := response.Metrics[i], response.Metrics[j]
+		if a.GetType() != b.GetType() {
+			return a.GetType() < b.GetType()
+		}
+		return models.SeriesID(a.GetId(), a.GetLabels()) < models.SeriesID(b.GetId(), b.GetLabels())
+	})
+	return response, nil
+}
+
+// grpcStorageError — то же, что storageErrorStatus, только в кодах gRPC.
+func grpcStorageError(err error) error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, models.ErrInvalidType),
+		errors.Is(err, models.ErrEmptyID),
+		errors.Is(err, models.ErrMissingValue),
+		errors.Is(err, models.ErrInvalidLabel),
+		errors.Is(err, models.ErrInvalidValue):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func hashInterceptor(key string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return nil, status.Error(codes.Internal, "unexpected request type")
+		}
+
+		var hash string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(pb.HashMetadataKey); len(values) > 0 {
+				hash = values[0]
+			}
+		}
+
+		valid, err := pb.CheckMessage(msg, key, hash)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to marshal request")
+		}
+		if !valid {
+			return nil, status.Error(codes.Unauthenticated, "invalid request signature")
+		}
+		return handler(ctx, req)
+	}
+}
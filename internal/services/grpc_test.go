@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"ypMetrics/internal/metrics"
+	pb "ypMetrics/internal/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newTestGRPCClient(t *testing.T, key string) (pb.MetricsClient, *metrics.MemStorage) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	storage := metrics.NewMemStorage()
+	addr, err := ListenGRPC(ctx, "127.0.0.1:0", storage, key)
+	require.NoError(t, err)
+
+	conn, err := grpc.NewClient(addr.String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewMetricsClient(conn), storage
+}
+
+func TestGRPCServer(t *testing.T) {
+	client, storage := newTestGRPCClient(t, "")
+	ctx := context.Background()
+
+	_, err := client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "Alloc", Type: pb.Metric_GAUGE, Value: 1.5},
+		{Id: "PollCount", Type: pb.Metric_COUNTER, Delta: 3},
+		{Id: "PollCount", Type: pb.Metric_COUNTER, Delta: 2},
+	}})
+	require.NoError(t, err)
+
+	counter, err := storage.GetMetricsByTypeAndName(ctx, "PollCount", "counter")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *counter.Delta)
+
+	got, err := client.GetMetric(ctx, &pb.GetMetricRequest{Id: "Alloc", Type: pb.Metric_GAUGE})
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, got.GetMetric().GetValue())
+
+	list, err := client.ListMetrics(ctx, &pb.ListMetricsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetMetrics(), 2)
+	assert.Equal(t, "Alloc", list.GetMetrics()[0].GetId())
+	assert.Equal(t, "PollCount", list.GetMetrics()[1].GetId())
+
+	tests := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{
+			name: "unknown metric",
+			call: func() error {
+				_, err := client.GetMetric(ctx, &pb.GetMetricRequest{Id: "Missing", Type: pb.Metric_GAUGE})
+				return err
+			},
+			want: codes.NotFound,
+		},
+		{
+			name: "unspecified type",
+			call: func() error {
+				_, err := client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{{Id: "x"}}})
+				return err
+			},
+			want: codes.InvalidArgument,
+		},
+		{
+			name: "empty batch",
+			call: func() error {
+				_, err := client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{})
+				return err
+			},
+			want: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, status.Code(tt.call()))
+		})
+	}
+}
+
+func TestGRPCServerLabels(t *testing.T) {
+	client, _ := newTestGRPCClient(t, "")
+	ctx := context.Background()
+
+	_, err := client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "Alloc", Type: pb.Metric_GAUGE, Value: 1, Labels: map[string]string{"host": "a"}},
+		{Id: "Alloc", Type: pb.Metric_GAUGE, Value: 2, Labels: map[string]string{"host": "b"}},
+	}})
+	require.NoError(t, err)
+
+	got, err := client.GetMetric(ctx, &pb.GetMetricRequest{Id: "Alloc", Type: pb.Metric_GAUGE, Labels: map[string]string{"host": "b"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, got.GetMetric().GetValue())
+	assert.Equal(t, map[string]string{"host": "b"}, got.GetMetric().GetLabels())
+
+	list, err := client.ListMetrics(ctx, &pb.ListMetricsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetMetrics(), 2)
+	assert.Equal(t, map[string]string{"host": "a"}, list.GetMetrics()[0].GetLabels())
+	assert.Equal(t, map[string]string{"host": "b"}, list.GetMetrics()[1].GetLabels())
+}
+
+func TestGRPCServerDistributions(t *testing.T) {
+	client, _ := newTestGRPCClient(t, "")
+	ctx := context.Background()
+
+	_, err := client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "latency", Type: pb.Metric_HISTOGRAM, Value: 0.3, Buckets: []float64{0.5, 1}},
+		{Id: "latency", Type: pb.Metric_HISTOGRAM, Value: 2},
+		{Id: "rt", Type: pb.Metric_SUMMARY, Value: 3, Quantiles: []float64{0.5}},
+	}})
+	require.NoError(t, err)
+
+	got, err := client.GetMetric(ctx, &pb.GetMetricRequest{Id: "latency", Type: pb.Metric_HISTOGRAM})
+	require.NoError(t, err)
+	histogram := got.GetMetric().GetHistogram()
+	assert.Equal(t, uint64(2), histogram.GetCount())
+	assert.Equal(t, 2.3, histogram.GetSum())
+	require.Len(t, histogram.GetBuckets(), 2)
+	assert.Equal(t, 0.5, histogram.GetBuckets()[0].GetUpperBound())
+	assert.Equal(t, uint64(1), histogram.GetBuckets()[0].GetCount())
+
+	list, err := client.ListMetrics(ctx, &pb.ListMetricsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetMetrics(), 2, "distributions are listed too")
+	assert.Equal(t, pb.Metric_HISTOGRAM, list.GetMetrics()[0].GetType())
+	assert.Equal(t, uint64(2), list.GetMetrics()[0].GetHistogram().GetCount())
+	assert.Equal(t, pb.Metric_SUMMARY, list.GetMetrics()[1].GetType())
+	assert.Equal(t, 3.0, list.GetMetrics()[1].GetSummary().GetQuantiles()[0].GetValue())
+
+	_, err = client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "latency", Type: pb.Metric_HISTOGRAM, Value: 1, Buckets: []float64{1, 0.5}},
+	}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCServerSigned(t *testing.T) {
+	const key = "secret"
+	client, _ := newTestGRPCClient(t, key)
+
+	req := &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{{Id: "Alloc", Type: pb.Metric_GAUGE, Value: 1}}}
+
+	_, err := client.UpdateMetrics(context.Background(), req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "unsigned request must be rejected")
+
+	badCtx := metadata.AppendToOutgoingContext(context.Background(), pb.HashMetadataKey, "deadbeef")
+	_, err = client.UpdateMetrics(badCtx, req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	hash, err := pb.SignMessage(req, key)
+	require.NoError(t, err)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), pb.HashMetadataKey, hash)
+	_, err = client.UpdateMetrics(ctx, req)
+	assert.NoError(t, err)
+}
@@ -1,11 +1,16 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	htmlpkg "html"
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"ypMetrics/internal/alerts"
 	"ypMetrics/internal/store"
 	"ypMetrics/models"
 
@@ -14,11 +19,19 @@ import (
 
 type Handler struct {
 	storage store.Storage
+	// alerts и silences равны nil, если алертинг выключен
+	alerts   *alerts.Engine
+	silences *alerts.Silences
+	// done закрывается при остановке сервера: Shutdown не ждёт конца бесконечных потоков
+	done <-chan struct{}
+	// cumulative — прошлые точки кумулятивных счётчиков OTLP
+	cumulative *otlpCumulative
 }
 
 func NewHandler(s store.Storage) Handler {
 	return Handler{
-		storage: s,
+		storage:    s,
+		cumulative: newOTLPCumulative(),
 	}
 }
 
@@ -35,6 +48,13 @@ func (h *Handler) updateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	labels, err := queryLabels(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	seriesID := models.SeriesID(metricName, labels)
+
 	switch metricType {
 	case models.Gauge:
 		value, err := strconv.ParseFloat(metricValue, 64)
@@ -42,7 +62,10 @@ func (h *Handler) updateHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid gauge value", http.StatusBadRequest)
 			return
 		}
-		h.storage.UpdateGauge(metricName, value)
+		if err := h.storage.UpdateGauge(r.Context(), seriesID, value); err != nil {
+			writeStorageError(w, err)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "Gauge %s updated to %f", metricName, value)
 	case models.Counter:
@@ -51,22 +74,106 @@ func (h *Handler) updateHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid counter value", http.StatusBadRequest)
 			return
 		}
-		newValue := h.storage.UpdateCounter(metricName, value)
+		newValue, err := h.storage.UpdateCounter(r.Context(), seriesID, value)
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "Counter %s incremented by %d, new value: %d", metricName, value, newValue)
+	case models.Histogram, models.Summary:
+		value, err := strconv.ParseFloat(metricValue, 64)
+		if err != nil {
+			http.Error(w, "Invalid observation value", http.StatusBadRequest)
+			return
+		}
+		metric := models.Metrics{ID: metricName, MType: metricType, Value: &value, Labels: labels}
+		if err := h.storage.UpdateBatch(r.Context(), []models.Metrics{metric}); err != nil {
+			writeStorageError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "Observed %f in %s %s", value, metricType, metricName)
 	default:
 		mes := fmt.Sprintf("Invalid metric type %s", metricType)
 		http.Error(w, mes, http.StatusBadRequest)
 	}
 }
 
+func (h *Handler) updateJSONHandler(w http.ResponseWriter, r *http.Request) {
+	var metric models.Metrics
+	if err := json.NewDecoder(r.Body).Decode(&metric); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if metric.ID == "" {
+		http.Error(w, "Metric id is required", http.StatusNotFound)
+		return
+	}
+
+	if err := metric.Labels.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := models.Metrics{ID: metric.ID, MType: metric.MType, Labels: metric.Labels}
+
+	switch metric.MType {
+	case models.Gauge:
+		if metric.Value == nil {
+			http.Error(w, "Invalid gauge value", http.StatusBadRequest)
+			return
+		}
+		if err := h.storage.UpdateGauge(r.Context(), metric.SeriesID(), *metric.Value); err != nil {
+			writeStorageError(w, err)
+			return
+		}
+		response.Value = metric.Value
+	case models.Counter:
+		if metric.Delta == nil {
+			http.Error(w, "Invalid counter value", http.StatusBadRequest)
+			return
+		}
+		newValue, err := h.storage.UpdateCounter(r.Context(), metric.SeriesID(), *metric.Delta)
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
+		response.Delta = &newValue
+	case models.Histogram, models.Summary:
+		// наблюдение применяется так же, как в пачке, а в ответ уходит
+		// состояние серии после него
+		if err := h.storage.UpdateBatch(r.Context(), []models.Metrics{metric}); err != nil {
+			writeStorageError(w, err)
+			return
+		}
+		stored, err := h.storage.GetMetricsByTypeAndName(r.Context(), metric.SeriesID(), metric.MType)
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
+		response = stored
+	default:
+		mes := fmt.Sprintf("Invalid metric type %s", metric.MType)
+		http.Error(w, mes, http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
 func (h *Handler) errorHandler(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "Invalid URL format", http.StatusNotFound)
 }
 
 func (h *Handler) metricsHandler(w http.ResponseWriter, r *http.Request) {
-	metrics := h.storage.GetAllMetrics()
-	jsonData, err := json.MarshalIndent(metrics, "", "  ")
+	metrics, err := h.storage.GetAllMetrics(r.Context())
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	jsonData, err := json.MarshalIndent(newMetricsView(metrics), "", "  ")
 	if err != nil {
 		http.Error(w, "Failed to serialize metrics", http.StatusInternalServerError)
 		return
@@ -76,13 +183,44 @@ func (h *Handler) metricsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonData)
 }
 
+// metricsView — снимок для чтения: гистограммы и summary в том же виде,
+// что и в /value/, без служебного окна наблюдений.
+type metricsView struct {
+	Gauges     map[string]float64              `json:"gauges"`
+	Counters   map[string]int64                `json:"counters"`
+	Histograms map[string]models.HistogramData `json:"histograms,omitempty"`
+	Summaries  map[string]models.SummaryData   `json:"summaries,omitempty"`
+}
+
+func newMetricsView(snapshot store.Snapshot) metricsView {
+	view := metricsView{Gauges: snapshot.Gauges, Counters: snapshot.Counters}
+	if len(snapshot.Histograms) > 0 {
+		view.Histograms = make(map[string]models.HistogramData, len(snapshot.Histograms))
+		for name, h := range snapshot.Histograms {
+			view.Histograms[name] = h.Data()
+		}
+	}
+	if len(snapshot.Summaries) > 0 {
+		view.Summaries = make(map[string]models.SummaryData, len(snapshot.Summaries))
+		for name, s := range snapshot.Summaries {
+			view.Summaries[name] = s.Data()
+		}
+	}
+	return view
+}
+
 func (h *Handler) metricsHTMLHandler(w http.ResponseWriter, r *http.Request) {
 
-    metrics := h.storage.GetAllMetrics()
+    metrics, err := h.storage.GetAllMetrics(r.Context())
+    if err != nil {
+        writeStorageError(w, err)
+        return
+    }
     
+    // в имена серий попадают значения меток от клиентов
     html:= models.HTMLHead
 
-    if gauges, ok := metrics["gauges"].(map[string]float64); ok && len(gauges) > 0 {
+    if gauges := metrics.Gauges; len(gauges) > 0 {
         html += `<div class="metric-section">
             <h2>Gauge Metrics</h2>`
         
@@ -90,13 +228,13 @@ func (h *Handler) metricsHTMLHandler(w http.ResponseWriter, r *http.Request) {
             html += fmt.Sprintf(`
             <div class="metric-item">
                 <span class="metric-name">%s:</span>
-                <span class="metric-value">%.2f</span>
-            </div>`, name, value)
+                <span class="metric-value" data-metric="%s">%.2f</span>
+            </div>`, htmlpkg.EscapeString(name), dataMetric(models.Gauge, name), value)
         }
         html += `</div>`
     }
 
-    if counters, ok := metrics["counters"].(map[string]int64); ok && len(counters) > 0 {
+    if counters := metrics.Counters; len(counters) > 0 {
         html += `<div class="metric-section">
             <h2>Counter Metrics</h2>`
         
@@ -104,22 +242,62 @@ func (h *Handler) metricsHTMLHandler(w http.ResponseWriter, r *http.Request) {
             html += fmt.Sprintf(`
             <div class="metric-item">
                 <span class="metric-name">%s:</span>
-                <span class="metric-value">%d</span>
-            </div>`, name, value)
+                <span class="metric-value" data-metric="%s">%d</span>
+            </div>`, htmlpkg.EscapeString(name), dataMetric(models.Counter, name), value)
         }        
         html += `</div>`
     }
 
-    if len(metrics) == 0 {
+    if histograms := metrics.Histograms; len(histograms) > 0 {
+        html += `<div class="metric-section">
+            <h2>Histogram Metrics</h2>`
+
+        for _, name := range sortedKeys(histograms) {
+            data := histograms[name].Data()
+            buckets := make([]string, 0, len(data.Buckets))
+            for _, b := range data.Buckets {
+                buckets = append(buckets, fmt.Sprintf("≤%g: %d", b.UpperBound, b.Count))
+            }
+            html += fmt.Sprintf(`
+            <div class="metric-item">
+                <span class="metric-name">%s:</span>
+                <span class="metric-value">count %d, sum %.2f (%s)</span>
+            </div>`, htmlpkg.EscapeString(name), data.Count, data.Sum, htmlpkg.EscapeString(strings.Join(buckets, ", ")))
+        }
+        html += `</div>`
+    }
+
+    if summaries := metrics.Summaries; len(summaries) > 0 {
+        html += `<div class="metric-section">
+            <h2>Summary Metrics</h2>`
+
+        for _, name := range sortedKeys(summaries) {
+            data := summaries[name].Data()
+            quantiles := make([]string, 0, len(data.Quantiles))
+            for _, q := range data.Quantiles {
+                quantiles = append(quantiles, fmt.Sprintf("p%g: %.2f", q.Quantile*100, q.Value))
+            }
+            html += fmt.Sprintf(`
+            <div class="metric-item">
+                <span class="metric-name">%s:</span>
+                <span class="metric-value">count %d, sum %.2f (%s)</span>
+            </div>`, htmlpkg.EscapeString(name), data.Count, data.Sum, htmlpkg.EscapeString(strings.Join(quantiles, ", ")))
+        }
+        html += `</div>`
+    }
+
+    if len(metrics.Gauges) == 0 && len(metrics.Counters) == 0 &&
+        len(metrics.Histograms) == 0 && len(metrics.Summaries) == 0 {
         html += `<p>No metrics available</p>`
     }
 
+    html += models.HTMLLiveScript
     html += `</body></html>`
 
     w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	
-	_, err := io.WriteString(w, html)
+	_, err = io.WriteString(w, html)
     if err != nil {
         http.Error(w, "Internal Server Error", http.StatusInternalServerError)
         return
@@ -127,6 +305,11 @@ func (h *Handler) metricsHTMLHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 
+// dataMetric — ключ элемента для обновления значения из /stream.
+func dataMetric(mType, seriesID string) string {
+	return htmlpkg.EscapeString(mType + ":" + seriesID)
+}
+
 func (h *Handler) getMetricHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
@@ -138,13 +321,210 @@ func (h *Handler) getMetricHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jsonData, err:= h.storage.GetMetricsByTypeAndName(metricName, metricType)
+	labels, err := queryLabels(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metric, err:= h.storage.GetMetricsByTypeAndName(r.Context(), models.SeriesID(metricName, labels), metricType)
 	if err!=nil{
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprintf(w, "ERROR Handler: %s", err)
-	} else {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write(jsonData)
-	}	
-}
\ No newline at end of file
+		writeLookupError(w, err)
+		return
+	}
+
+	var value interface{}
+	switch metric.MType {
+	case models.Gauge:
+		value = metric.Value
+	case models.Counter:
+		value = metric.Delta
+	case models.Histogram:
+		value = metric.Histogram
+	case models.Summary:
+		value = metric.Summary
+	}
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, "Failed to serialize metric", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (h *Handler) getMetricJSONHandler(w http.ResponseWriter, r *http.Request) {
+	var metric models.Metrics
+	if err := json.NewDecoder(r.Body).Decode(&metric); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if metric.ID == "" || metric.MType == "" {
+		http.Error(w, "Metric id and type are required", http.StatusNotFound)
+		return
+	}
+
+	if err := metric.Labels.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.storage.GetMetricsByTypeAndName(r.Context(), metric.SeriesID(), metric.MType)
+	if err != nil {
+		writeLookupError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *Handler) updatesHandler(w http.ResponseWriter, r *http.Request) {
+	var metrics []models.Metrics
+	if err := json.NewDecoder(r.Body).Decode(&metrics); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if len(metrics) == 0 {
+		http.Error(w, "Empty metrics batch", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.storage.UpdateBatch(r.Context(), metrics); err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) deleteMetricHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	metricType := vars["type"]
+	metricName := vars["name"]
+
+	labels, err := queryLabels(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.storage.DeleteMetric(r.Context(), models.SeriesID(metricName, labels), metricType); err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Metric %s of type %s deleted", metricName, metricType)
+}
+
+func (h *Handler) resetCounterHandler(w http.ResponseWriter, r *http.Request) {
+	metricName := mux.Vars(r)["name"]
+
+	labels, err := queryLabels(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.storage.ResetCounter(r.Context(), models.SeriesID(metricName, labels)); err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Counter %s reset", metricName)
+}
+
+// deleteByPrefixHandler требует непустой prefix, чтобы случайный
+// DELETE /values/ не стёр всё хранилище.
+func (h *Handler) deleteByPrefixHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		http.Error(w, "Query parameter prefix is required", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.storage.DeleteByPrefix(r.Context(), prefix)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"deleted": deleted})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonData)
+}
+
+func (h *Handler) pingHandler(w http.ResponseWriter, r *http.Request) {
+	if err := h.storage.Ping(r.Context()); err != nil {
+		http.Error(w, fmt.Sprintf("Storage is unavailable: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "OK")
+}
+
+// queryLabels читает метки серии из параметров запроса:
+// /update/gauge/Alloc/1.5?host=a&region=eu. Параметры из reserved
+// принадлежат самому обработчику и метками не считаются.
+func queryLabels(r *http.Request, reserved ...string) (models.Labels, error) {
+	query := r.URL.Query()
+	for _, k := range reserved {
+		query.Del(k)
+	}
+	if len(query) == 0 {
+		return nil, nil
+	}
+	labels := make(models.Labels, len(query))
+	for k, values := range query {
+		if len(values) > 1 {
+			return nil, fmt.Errorf("%w: '%s' is set more than once", models.ErrInvalidLabel, k)
+		}
+		labels[k] = values[0]
+	}
+	if err := labels.Validate(); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// storageErrorStatus переводит ошибку хранилища в HTTP-статус.
+func storageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrInvalidType),
+		errors.Is(err, models.ErrEmptyID),
+		errors.Is(err, models.ErrMissingValue),
+		errors.Is(err, models.ErrInvalidLabel),
+		errors.Is(err, models.ErrInvalidValue):
+		return http.StatusBadRequest
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeStorageError(w http.ResponseWriter, err error) {
+	http.Error(w, fmt.Sprintf("ERROR Handler: %s", err), storageErrorStatus(err))
+}
+
+// writeLookupError — для чтения неизвестный тип метрики тоже означает «не найдено».
+func writeLookupError(w http.ResponseWriter, err error) {
+	status := storageErrorStatus(err)
+	if status == http.StatusBadRequest {
+		status = http.StatusNotFound
+	}
+	http.Error(w, fmt.Sprintf("ERROR Handler: %s", err), status)
+}
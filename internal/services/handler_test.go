@@ -1,64 +1,140 @@
 package services
 
 import (
+	"bytes"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"encoding/json"
+	"strings"
+	"ypMetrics/internal/metrics"
 	"ypMetrics/internal/store"
+	"ypMetrics/models"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type MockStorage struct {
     store.Storage
 	gauges    map[string]float64
     counters  map[string]int64
-	UpdateGaugeFunc func(name string, value float64) 
-	UpdateCounterFunc func(name string, value int64) int64 
-	GetMetricsByTypeAndNameFunc func(mName, mType string) ([]byte, error) 
+	UpdateGaugeFunc func(name string, value float64) error
+	UpdateCounterFunc func(name string, value int64) (int64, error)
+	GetMetricsByTypeAndNameFunc func(mName, mType string) (models.Metrics, error)
+	UpdateBatchFunc func(metrics []models.Metrics) error
+	PingFunc func() error
+	GetAllMetricsFunc func() (store.Snapshot, error)
+}
+
+func (m *MockStorage) GetAllMetrics(ctx context.Context) (store.Snapshot, error) {
+	if m.GetAllMetricsFunc != nil {
+		return m.GetAllMetricsFunc()
+	}
+	return store.Snapshot{Gauges: m.gauges, Counters: m.counters}, nil
 }
 
-func (m *MockStorage) UpdateGauge(name string,value float64){
+func (m *MockStorage) Ping(ctx context.Context) error {
+	if m.PingFunc != nil {
+		return m.PingFunc()
+	}
+	return nil
+}
+
+func (m *MockStorage) UpdateBatch(ctx context.Context, metrics []models.Metrics) error {
+	if m.UpdateBatchFunc != nil {
+		return m.UpdateBatchFunc(metrics)
+	}
+	return nil
+}
+
+func (m *MockStorage) UpdateGauge(ctx context.Context, name string, value float64) error {
     if m.UpdateGaugeFunc != nil {
-        m.UpdateGaugeFunc(name,value)
+        return m.UpdateGaugeFunc(name, value)
     }
-   
+    return nil
 }
 
-func (m *MockStorage) UpdateCounter(name string, value int64) int64 {
+func (m *MockStorage) UpdateCounter(ctx context.Context, name string, value int64) (int64, error) {
     if m.UpdateCounterFunc != nil {
         return m.UpdateCounterFunc(name, value)
     }
-    return 0 // Дефолтное поведение
+    return 0, nil // Дефолтное поведение
 }
 
-func (m *MockStorage) GetMetricsByTypeAndName(mName, mType string) ([]byte, error) {
-	var value interface{}
+func (m *MockStorage) GetMetricsByTypeAndName(ctx context.Context, mName, mType string) (models.Metrics, error) {
+	if m.GetMetricsByTypeAndNameFunc != nil {
+		return m.GetMetricsByTypeAndNameFunc(mName, mType)
+	}
+
+	metric := models.Metrics{ID: mName, MType: mType}
 	var found bool
 
 	switch mType {
 	case "gauge":
-		value, found = m.gauges[mName]
+		var value float64
+		if value, found = m.gauges[mName]; found {
+			metric.Value = &value
+		}
 	case "counter":
-		value, found = m.counters[mName]
+		var delta int64
+		if delta, found = m.counters[mName]; found {
+			metric.Delta = &delta
+		}
 	default:
-		return nil, errors.New("invalid metric type")
+		return models.Metrics{}, models.ErrInvalidType
 	}
 
 	if !found {
-		return nil, fmt.Errorf("metric '%s' of type '%s' not found", mName, mType)
+		return models.Metrics{}, fmt.Errorf("metric '%s' of type '%s' %w", mName, mType, store.ErrNotFound)
 	}
+	return metric, nil
+}
 
+func (m *MockStorage) DeleteMetric(ctx context.Context, mName, mType string) error {
+	var found bool
+	switch mType {
+	case "gauge":
+		_, found = m.gauges[mName]
+		delete(m.gauges, mName)
+	case "counter":
+		_, found = m.counters[mName]
+		delete(m.counters, mName)
+	default:
+		return models.ErrInvalidType
+	}
+	if !found {
+		return fmt.Errorf("metric '%s' of type '%s' %w", mName, mType, store.ErrNotFound)
+	}
+	return nil
+}
 
-	jsonData, err := json.Marshal(value)
-		if err != nil {
-			return nil,fmt.Errorf("failed to marshal metric: %w", err)
+func (m *MockStorage) ResetCounter(ctx context.Context, name string) error {
+	if _, ok := m.counters[name]; !ok {
+		return fmt.Errorf("metric '%s' of type 'counter' %w", name, store.ErrNotFound)
 	}
+	m.counters[name] = 0
+	return nil
+}
 
-	return jsonData, nil
+func (m *MockStorage) DeleteByPrefix(ctx context.Context, prefix string) (int, error) {
+	deleted := 0
+	for name := range m.gauges {
+		if strings.HasPrefix(name, prefix) {
+			delete(m.gauges, name)
+			deleted++
+		}
+	}
+	for name := range m.counters {
+		if strings.HasPrefix(name, prefix) {
+			delete(m.counters, name)
+			deleted++
+		}
+	}
+	return deleted, nil
 }
 
 func (m *MockStorage) WithGauge(name string, value float64) *MockStorage {
@@ -203,3 +279,524 @@ func TestGetMetricHandler(t *testing.T) {
 	}
 }
 
+func TestUpdateJSONHandler(t *testing.T) {
+	mock := &MockStorage{
+		UpdateCounterFunc: func(name string, value int64) (int64, error) {
+			return value + 10, nil
+		},
+	}
+	handler := NewHandler(mock)
+
+	type want struct {
+		statusCode int
+		body       string
+	}
+	tests := []struct {
+		name string
+		body string
+		want want
+	}{
+		{
+			name: "valid gauge",
+			body: `{"id":"Alloc","type":"gauge","value":123.456789}`,
+			want: want{
+				statusCode: http.StatusOK,
+				body:       `{"id":"Alloc","type":"gauge","value":123.456789}`,
+			},
+		},
+		{
+			name: "valid counter returns new value",
+			body: `{"id":"PollCount","type":"counter","delta":5}`,
+			want: want{
+				statusCode: http.StatusOK,
+				body:       `{"id":"PollCount","type":"counter","delta":15}`,
+			},
+		},
+		{
+			name: "labels are echoed back",
+			body: `{"id":"Alloc","type":"gauge","value":1,"labels":{"host":"a"}}`,
+			want: want{
+				statusCode: http.StatusOK,
+				body:       `{"id":"Alloc","type":"gauge","value":1,"labels":{"host":"a"}}`,
+			},
+		},
+		{
+			name: "empty label value",
+			body: `{"id":"Alloc","type":"gauge","value":1,"labels":{"host":""}}`,
+			want: want{
+				statusCode: http.StatusBadRequest,
+				body:       "invalid label",
+			},
+		},
+		{
+			name: "gauge without value",
+			body: `{"id":"Alloc","type":"gauge"}`,
+			want: want{
+				statusCode: http.StatusBadRequest,
+				body:       "Invalid gauge value",
+			},
+		},
+		{
+			name: "missing id",
+			body: `{"type":"counter","delta":1}`,
+			want: want{
+				statusCode: http.StatusNotFound,
+				body:       "Metric id is required",
+			},
+		},
+		{
+			name: "invalid type",
+			body: `{"id":"Alloc","type":"invalid","value":1}`,
+			want: want{
+				statusCode: http.StatusBadRequest,
+				body:       "Invalid metric type invalid",
+			},
+		},
+		{
+			name: "broken json",
+			body: `{"id":`,
+			want: want{
+				statusCode: http.StatusBadRequest,
+				body:       "Invalid JSON body",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodPost, "/update/", bytes.NewBufferString(tt.body))
+			record := httptest.NewRecorder()
+
+			handler.updateJSONHandler(record, request)
+
+			assert.Equal(t, tt.want.statusCode, record.Code)
+			if tt.want.statusCode == http.StatusOK {
+				assert.Equal(t, "application/json", record.Header().Get("Content-Type"))
+				assert.JSONEq(t, tt.want.body, record.Body.String())
+			} else {
+				assert.Contains(t, record.Body.String(), tt.want.body)
+			}
+		})
+	}
+}
+
+func TestGetMetricJSONHandler(t *testing.T) {
+	mock := &MockStorage{
+		gauges: map[string]float64{
+			"temperature": 36.6,
+		},
+		counters: map[string]int64{
+			"requests": 42,
+		},
+	}
+	handler := NewHandler(mock)
+
+	type want struct {
+		statusCode int
+		body       string
+	}
+	tests := []struct {
+		name string
+		body string
+		want want
+	}{
+		{
+			name: "successful gauge request",
+			body: `{"id":"temperature","type":"gauge"}`,
+			want: want{
+				statusCode: http.StatusOK,
+				body:       `{"id":"temperature","type":"gauge","value":36.6}`,
+			},
+		},
+		{
+			name: "successful counter request",
+			body: `{"id":"requests","type":"counter"}`,
+			want: want{
+				statusCode: http.StatusOK,
+				body:       `{"id":"requests","type":"counter","delta":42}`,
+			},
+		},
+		{
+			name: "missing metric",
+			body: `{"id":"humidity","type":"gauge"}`,
+			want: want{
+				statusCode: http.StatusNotFound,
+				body:       `metric 'humidity' of type 'gauge' not found`,
+			},
+		},
+		{
+			name: "invalid type",
+			body: `{"id":"temperature","type":"invalid"}`,
+			want: want{
+				statusCode: http.StatusNotFound,
+				body:       `invalid metric type`,
+			},
+		},
+		{
+			name: "missing type",
+			body: `{"id":"temperature"}`,
+			want: want{
+				statusCode: http.StatusNotFound,
+				body:       `Metric id and type are required`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodPost, "/value/", bytes.NewBufferString(tt.body))
+			record := httptest.NewRecorder()
+
+			handler.getMetricJSONHandler(record, request)
+
+			assert.Equal(t, tt.want.statusCode, record.Code)
+			if tt.want.statusCode == http.StatusOK {
+				assert.JSONEq(t, tt.want.body, record.Body.String())
+			} else {
+				assert.Contains(t, record.Body.String(), tt.want.body)
+			}
+		})
+	}
+}
+
+func TestUpdatesHandler(t *testing.T) {
+	var applied []models.Metrics
+	mock := &MockStorage{
+		UpdateBatchFunc: func(metrics []models.Metrics) error {
+			for _, m := range metrics {
+				if err := m.Validate(); err != nil {
+					return err
+				}
+			}
+			applied = metrics
+			return nil
+		},
+	}
+	handler := NewHandler(mock)
+
+	tests := []struct {
+		name        string
+		body        string
+		statusCode  int
+		wantApplied int
+	}{
+		{
+			name:        "valid batch",
+			body:        `[{"id":"Alloc","type":"gauge","value":1.5},{"id":"PollCount","type":"counter","delta":3}]`,
+			statusCode:  http.StatusOK,
+			wantApplied: 2,
+		},
+		{
+			name:       "invalid metric rejects whole batch",
+			body:       `[{"id":"Alloc","type":"gauge","value":1.5},{"id":"PollCount","type":"counter"}]`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "empty batch",
+			body:       `[]`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "not an array",
+			body:       `{"id":"Alloc","type":"gauge","value":1.5}`,
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied = nil
+			request, _ := http.NewRequest(http.MethodPost, "/updates/", bytes.NewBufferString(tt.body))
+			record := httptest.NewRecorder()
+
+			handler.updatesHandler(record, request)
+
+			assert.Equal(t, tt.statusCode, record.Code)
+			assert.Len(t, applied, tt.wantApplied)
+		})
+	}
+}
+
+func TestStorageErrorStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		statusCode int
+	}{
+		{"not found", fmt.Errorf("metric 'x' of type 'gauge' %w", store.ErrNotFound), http.StatusNotFound},
+		{"invalid type", models.ErrInvalidType, http.StatusBadRequest},
+		{"missing value", fmt.Errorf("gauge 'x': %w", models.ErrMissingValue), http.StatusBadRequest},
+		{"cancelled request", context.Canceled, http.StatusServiceUnavailable},
+		{"backend failure", errors.New("connection refused"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.statusCode, storageErrorStatus(tt.err))
+		})
+	}
+}
+
+func TestUpdateHandlerStorageFailure(t *testing.T) {
+	mock := &MockStorage{
+		UpdateGaugeFunc: func(name string, value float64) error {
+			return errors.New("disk is full")
+		},
+	}
+	handler := NewHandler(mock)
+
+	request, _ := http.NewRequest(http.MethodPost, "/update", nil)
+	request = mux.SetURLVars(request, map[string]string{
+		"type":  "gauge",
+		"name":  "Alloc",
+		"value": "1.5",
+	})
+	record := httptest.NewRecorder()
+
+	handler.updateHandler(record, request)
+
+	assert.Equal(t, http.StatusInternalServerError, record.Code)
+	assert.Contains(t, record.Body.String(), "disk is full")
+}
+
+func TestPingHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		pingErr    error
+		statusCode int
+	}{
+		{"storage is reachable", nil, http.StatusOK},
+		{"storage is down", errors.New("connection refused"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &MockStorage{PingFunc: func() error { return tt.pingErr }}
+			handler := NewHandler(mock)
+
+			request, _ := http.NewRequest(http.MethodGet, "/ping", nil)
+			record := httptest.NewRecorder()
+
+			handler.pingHandler(record, request)
+
+			assert.Equal(t, tt.statusCode, record.Code)
+		})
+	}
+}
+
+func TestDeleteMetricHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		mType      string
+		mName      string
+		statusCode int
+	}{
+		{"delete gauge", "gauge", "Alloc", http.StatusOK},
+		{"delete counter", "counter", "PollCount", http.StatusOK},
+		{"unknown metric", "gauge", "Missing", http.StatusNotFound},
+		{"wrong type for name", "counter", "Alloc", http.StatusNotFound},
+		{"invalid type", "histogram", "Alloc", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := (&MockStorage{gauges: map[string]float64{}, counters: map[string]int64{}}).
+				WithGauge("Alloc", 1.5).
+				WithCounter("PollCount", 5)
+			handler := NewHandler(mock)
+
+			request, _ := http.NewRequest(http.MethodDelete, "/value/"+tt.mType+"/"+tt.mName, nil)
+			request = mux.SetURLVars(request, map[string]string{"type": tt.mType, "name": tt.mName})
+			record := httptest.NewRecorder()
+
+			handler.deleteMetricHandler(record, request)
+
+			assert.Equal(t, tt.statusCode, record.Code)
+			if tt.statusCode == http.StatusOK {
+				_, err := mock.GetMetricsByTypeAndName(context.Background(), tt.mName, tt.mType)
+				assert.ErrorIs(t, err, store.ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestResetCounterHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		mName      string
+		statusCode int
+		wantValue  int64
+	}{
+		{"existing counter", "PollCount", http.StatusOK, 0},
+		{"unknown counter", "Missing", http.StatusNotFound, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := (&MockStorage{gauges: map[string]float64{}, counters: map[string]int64{}}).
+				WithCounter("PollCount", 5)
+			handler := NewHandler(mock)
+
+			request, _ := http.NewRequest(http.MethodPost, "/reset/counter/"+tt.mName, nil)
+			request = mux.SetURLVars(request, map[string]string{"name": tt.mName})
+			record := httptest.NewRecorder()
+
+			handler.resetCounterHandler(record, request)
+
+			assert.Equal(t, tt.statusCode, record.Code)
+			assert.Equal(t, tt.wantValue, mock.counters["PollCount"])
+		})
+	}
+}
+
+func TestDeleteByPrefixHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		statusCode  int
+		wantDeleted int
+		wantLeft    []string
+	}{
+		{"matching prefix", "?prefix=bad.", http.StatusOK, 3, []string{"Alloc", "PollCount"}},
+		{"nothing matches", "?prefix=none", http.StatusOK, 0, []string{"Alloc", "PollCount", "bad.a", "bad.b", "bad.c"}},
+		{"missing prefix", "", http.StatusBadRequest, 0, []string{"Alloc", "PollCount", "bad.a", "bad.b", "bad.c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := (&MockStorage{gauges: map[string]float64{}, counters: map[string]int64{}}).
+				WithGauge("Alloc", 1).
+				WithGauge("bad.a", 1).
+				WithGauge("bad.b", 2).
+				WithCounter("PollCount", 1).
+				WithCounter("bad.c", 3)
+			handler := NewHandler(mock)
+
+			request, _ := http.NewRequest(http.MethodDelete, "/values/"+tt.query, nil)
+			record := httptest.NewRecorder()
+
+			handler.deleteByPrefixHandler(record, request)
+
+			assert.Equal(t, tt.statusCode, record.Code)
+			if tt.statusCode == http.StatusOK {
+				var response map[string]int
+				require.NoError(t, json.Unmarshal(record.Body.Bytes(), &response))
+				assert.Equal(t, tt.wantDeleted, response["deleted"])
+			}
+
+			var left []string
+			for name := range mock.gauges {
+				left = append(left, name)
+			}
+			for name := range mock.counters {
+				left = append(left, name)
+			}
+			assert.ElementsMatch(t, tt.wantLeft, left)
+		})
+	}
+}
+
+func TestLabeledSeries(t *testing.T) {
+	handler := NewHandler(metrics.NewMemStorage())
+	router := mux.NewRouter()
+	router.HandleFunc("/update/{type}/{name}/{value}", handler.updateHandler).Methods(http.MethodPost)
+	router.HandleFunc("/value/{type}/{name}", handler.getMetricHandler).Methods(http.MethodGet)
+	router.HandleFunc("/value/", handler.getMetricJSONHandler).Methods(http.MethodPost)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, request)
+		return record
+	}
+
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/update/gauge/Alloc/1?host=a", "").Code)
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/update/gauge/Alloc/2?host=b", "").Code)
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/update/gauge/Alloc/3", "").Code)
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/value/gauge/Alloc?host=a", "1"},
+		{"/value/gauge/Alloc?host=b", "2"},
+		{"/value/gauge/Alloc", "3"},
+	}
+	for _, tt := range tests {
+		record := do(http.MethodGet, tt.target, "")
+		assert.Equal(t, http.StatusOK, record.Code, tt.target)
+		assert.Equal(t, tt.want, record.Body.String(), tt.target)
+	}
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/value/gauge/Alloc?host=c", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/update/gauge/Alloc/1?host=a&host=b", "").Code)
+
+	record := do(http.MethodPost, "/value/", `{"id":"Alloc","type":"gauge","labels":{"host":"b"}}`)
+	assert.Equal(t, http.StatusOK, record.Code)
+	assert.JSONEq(t, `{"id":"Alloc","type":"gauge","value":2,"labels":{"host":"b"}}`, record.Body.String())
+
+	// имя с запятой не перезаписывает чужую серию с метками
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/update/gauge/Alloc,host=a/4", "").Code)
+	assert.Equal(t, "1", do(http.MethodGet, "/value/gauge/Alloc?host=a", "").Body.String())
+	assert.Equal(t, "4", do(http.MethodGet, "/value/gauge/Alloc,host=a", "").Body.String())
+}
+
+func TestDistributionHandlers(t *testing.T) {
+	handler := NewHandler(metrics.NewMemStorage())
+	router := mux.NewRouter()
+	router.HandleFunc("/update/{type}/{name}/{value}", handler.updateHandler).Methods(http.MethodPost)
+	router.HandleFunc("/update/", handler.updateJSONHandler).Methods(http.MethodPost)
+	router.HandleFunc("/value/{type}/{name}", handler.getMetricHandler).Methods(http.MethodGet)
+	router.HandleFunc("/metrics", handler.metricsHandler).Methods(http.MethodPost)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, request)
+		return record
+	}
+
+	record := do(http.MethodPost, "/update/", `{"id":"latency","type":"histogram","value":0.3,"buckets":[0.5,1]}`)
+	require.Equal(t, http.StatusOK, record.Code, record.Body.String())
+	assert.JSONEq(t, `{"id":"latency","type":"histogram","histogram":{"buckets":[{"le":0.5,"count":1},{"le":1,"count":1}],"count":1,"sum":0.3}}`, record.Body.String())
+
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/update/histogram/latency/0.8", "").Code)
+	record = do(http.MethodGet, "/value/histogram/latency", "")
+	assert.Equal(t, http.StatusOK, record.Code)
+	assert.JSONEq(t, `{"buckets":[{"le":0.5,"count":1},{"le":1,"count":2}],"count":2,"sum":1.1}`, record.Body.String())
+
+	record = do(http.MethodPost, "/update/", `{"id":"latency","type":"histogram","value":0.3,"buckets":[2]}`)
+	assert.Equal(t, http.StatusBadRequest, record.Code, "buckets of an existing histogram cannot change")
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/update/summary/rt/fast", "").Code)
+
+	for _, v := range []string{"1", "2", "3", "4"} {
+		require.Equal(t, http.StatusOK, do(http.MethodPost, "/update/summary/rt/"+v, "").Code)
+	}
+	record = do(http.MethodGet, "/value/summary/rt", "")
+	assert.Equal(t, http.StatusOK, record.Code)
+	assert.JSONEq(t, `{"quantiles":[{"quantile":0.5,"value":2},{"quantile":0.9,"value":4},{"quantile":0.99,"value":4}],"count":4,"sum":10}`, record.Body.String())
+
+	record = do(http.MethodPost, "/metrics", "")
+	assert.Equal(t, http.StatusOK, record.Code)
+	assert.Contains(t, record.Body.String(), `"histograms"`)
+	assert.NotContains(t, record.Body.String(), `"window"`, "summary window is internal state")
+}
+
+func TestMetricsHTMLHandlerEscapesNames(t *testing.T) {
+	ctx := context.Background()
+	storage := metrics.NewMemStorage()
+	require.NoError(t, storage.UpdateGauge(ctx, models.SeriesID("Alloc", models.Labels{"host": "<script>alert(1)</script>"}), 1))
+	_, err := storage.UpdateCounter(ctx, "<b>PollCount</b>", 1)
+	require.NoError(t, err)
+
+	handler := NewHandler(storage)
+	record := httptest.NewRecorder()
+	handler.metricsHTMLHandler(record, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusOK, record.Code)
+	body := record.Body.String()
+	assert.NotContains(t, body, "<script>alert(1)</script>")
+	assert.NotContains(t, body, "<b>PollCount</b>")
+	assert.Contains(t, body, "&lt;script&gt;alert(1)&lt;/script&gt;")
+	assert.Contains(t, body, "&lt;b&gt;PollCount&lt;/b&gt;")
+}
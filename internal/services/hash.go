@@ -0,0 +1,112 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"ypMetrics/internal/helper"
+
+	"github.com/gorilla/mux"
+)
+
+// hashResponseWriter копит ответ целиком: подпись нужно поставить
+// в заголовок до того, как уйдёт тело. Потоки (text/event-stream и
+// захваченные под WebSocket соединения) не кончаются, поэтому не подписываются.
+type hashResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+	streaming  bool
+}
+
+func (w *hashResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode != 0 {
+		return
+	}
+	w.statusCode = statusCode
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.streaming = true
+		w.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+func (w *hashResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.streaming {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+// Flush нужен только потокам, остальное уходит в flush после обработчика.
+func (w *hashResponseWriter) Flush() {
+	if w.streaming {
+		http.NewResponseController(w.ResponseWriter).Flush()
+	}
+}
+
+func (w *hashResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.streaming = true
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *hashResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *hashResponseWriter) flush(key string) {
+	if w.streaming {
+		return
+	}
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	w.Header().Set(helper.HashHeader, helper.ComputeHash(w.body.Bytes(), key))
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	w.ResponseWriter.Write(w.body.Bytes())
+}
+
+// requiresSignature — методы, которые меняют данные: их нужно подписывать,
+// даже если всё передано в URL.
+func requiresSignature(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func hashMiddleware(key string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "Failed to read body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			if requiresSignature(r.Method) || len(body) > 0 {
+				hash := r.Header.Get(helper.HashHeader)
+				if hash == "" {
+					http.Error(w, "Missing request signature", http.StatusBadRequest)
+					return
+				}
+				if !helper.CheckHash(helper.SignedData(r.Method, r.RequestURI, body), key, hash) {
+					http.Error(w, "Invalid request signature", http.StatusBadRequest)
+					return
+				}
+			}
+
+			hw := &hashResponseWriter{ResponseWriter: w}
+			next.ServeHTTP(hw, r)
+			hw.flush(key)
+		})
+	}
+}
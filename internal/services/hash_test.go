@@ -0,0 +1,148 @@
+package services
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ypMetrics/internal/helper"
+	"ypMetrics/internal/metrics"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashMiddleware(t *testing.T) {
+	const key = "secret"
+	handler := hashMiddleware(key)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"id":"Alloc","type":"gauge","value":1.5}`))
+	}))
+
+	body := []byte(`{"id":"Alloc","type":"gauge","value":1.5}`)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       []byte
+		hash       string
+		statusCode int
+	}{
+		{
+			name:       "valid signature",
+			body:       body,
+			hash:       helper.ComputeHash(body, key),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "wrong key",
+			body:       body,
+			hash:       helper.ComputeHash(body, "other"),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "missing signature",
+			body:       body,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "url update without signature",
+			target:     "/update/counter/PollCount/5",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "signed url update",
+			target:     "/update/counter/PollCount/5",
+			hash:       helper.ComputeHash([]byte("POST /update/counter/PollCount/5\n"), key),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "signature of another url",
+			target:     "/update/counter/PollCount/500",
+			hash:       helper.ComputeHash([]byte("POST /update/counter/PollCount/5\n"), key),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "delete without signature",
+			method:     http.MethodDelete,
+			target:     "/value/gauge/Alloc",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "query is signed with the body",
+			target:     "/update/?host=b",
+			body:       body,
+			hash:       helper.ComputeHash(body, key),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "signed query and body",
+			target:     "/update/?host=b",
+			body:       body,
+			hash:       helper.ComputeHash(append([]byte("POST /update/?host=b\n"), body...), key),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "get needs no signature",
+			method:     http.MethodGet,
+			target:     "/value/gauge/Alloc",
+			statusCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, target := tt.method, tt.target
+			if method == "" {
+				method = http.MethodPost
+			}
+			if target == "" {
+				target = "/update/"
+			}
+			request := httptest.NewRequest(method, target, bytes.NewReader(tt.body))
+			if tt.hash != "" {
+				request.Header.Set(helper.HashHeader, tt.hash)
+			}
+			record := httptest.NewRecorder()
+
+			handler.ServeHTTP(record, request)
+
+			assert.Equal(t, tt.statusCode, record.Code)
+			if tt.statusCode == http.StatusOK {
+				assert.True(t, helper.CheckHash(record.Body.Bytes(), key, record.Header().Get(helper.HashHeader)))
+			}
+		})
+	}
+}
+
+func TestRouterSignatureExemptions(t *testing.T) {
+	handler := NewHandler(metrics.NewMemStorage())
+	router := newRouter(&handler, "secret")
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		statusCode  int
+	}{
+		{name: "influx line protocol", target: "/write", contentType: "text/plain", body: "cpu value=1", statusCode: http.StatusNoContent},
+		{name: "otlp", target: "/v1/metrics", contentType: otlpJSONContentType, body: `{}`, statusCode: http.StatusOK},
+		{name: "json update", target: "/update/", contentType: "application/json", body: `{"id":"Alloc","type":"gauge","value":1}`, statusCode: http.StatusBadRequest},
+		{name: "silences", target: "/silences", contentType: "application/json", body: `{}`, statusCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, tt.target, bytes.NewBufferString(tt.body))
+			request.Header.Set("Content-Type", tt.contentType)
+			record := httptest.NewRecorder()
+			router.ServeHTTP(record, request)
+			assert.Equal(t, tt.statusCode, record.Code, record.Body.String())
+			if tt.statusCode == http.StatusBadRequest {
+				assert.Contains(t, record.Body.String(), "Missing request signature")
+			}
+		})
+	}
+}
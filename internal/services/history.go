@@ -0,0 +1,138 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// historyDefaultRange — окно по умолчанию, если from не задан
+	historyDefaultRange = time.Hour
+	// historyMaxPoints ограничивает ответ с шагом, как в Prometheus
+	historyMaxPoints = 11000
+)
+
+type historyResponse struct {
+	ID      string         `json:"id"`
+	MType   string         `json:"type"`
+	Labels  models.Labels  `json:"labels,omitempty"`
+	Samples []store.Sample `json:"samples"`
+}
+
+// historyHandler отдаёт историю серии: GET /history/{type}/{name}?from=&to=&step=.
+// from и to — unix-время в секундах или RFC 3339, по умолчанию последний час.
+// С step точки выравниваются по сетке from, from+step, ...: в каждой —
+// последнее значение, записанное не позже неё.
+func (h *Handler) historyHandler(w http.ResponseWriter, r *http.Request) {
+	reader, ok := store.As[store.HistoryReader](h.storage)
+	if !ok {
+		http.Error(w, "History is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	vars := mux.Vars(r)
+	metricType := vars["type"]
+	metricName := vars["name"]
+
+	labels, err := queryLabels(r, "from", "to", "step")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	to := time.Now()
+	if raw := query.Get("to"); raw != "" {
+		if to, err = parseHistoryTime(raw); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid to: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+	from := to.Add(-historyDefaultRange)
+	if raw := query.Get("from"); raw != "" {
+		if from, err = parseHistoryTime(raw); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid from: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if from.After(to) {
+		http.Error(w, "from must not be after to", http.StatusBadRequest)
+		return
+	}
+
+	var step time.Duration
+	if raw := query.Get("step"); raw != "" {
+		if step, err = parseHistoryStep(raw); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid step: %s", err), http.StatusBadRequest)
+			return
+		}
+		if to.Sub(from)/step > historyMaxPoints {
+			http.Error(w, fmt.Sprintf("Too many points, use a step of at least %s", to.Sub(from)/historyMaxPoints), http.StatusBadRequest)
+			return
+		}
+	}
+
+	samples, err := reader.History(r.Context(), models.SeriesID(metricName, labels), metricType, from, to)
+	if err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	if step > 0 {
+		samples = alignSamples(samples, from, to, step)
+	}
+
+	writeJSON(w, http.StatusOK, historyResponse{
+		ID:      metricName,
+		MType:   metricType,
+		Labels:  labels,
+		Samples: samples,
+	})
+}
+
+// alignSamples переносит точки на сетку с шагом step. Точки сетки,
+// до которых ещё ничего не записано, пропускаются.
+func alignSamples(samples []store.Sample, from, to time.Time, step time.Duration) []store.Sample {
+	aligned := make([]store.Sample, 0)
+	next := 0
+	var last *store.Sample
+	for t := from; !t.After(to); t = t.Add(step) {
+		for next < len(samples) && !samples[next].Time.After(t) {
+			last = &samples[next]
+			next++
+		}
+		if last != nil {
+			aligned = append(aligned, store.Sample{Time: t, Value: last.Value})
+		}
+	}
+	return aligned
+}
+
+func parseHistoryTime(raw string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(raw, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+// parseHistoryStep принимает длительность Go ("30s", "5m") или число секунд.
+func parseHistoryStep(raw string) (time.Duration, error) {
+	step, err := time.ParseDuration(raw)
+	if err != nil {
+		seconds, parseErr := strconv.ParseFloat(raw, 64)
+		if parseErr != nil {
+			return 0, err
+		}
+		step = time.Duration(seconds * float64(time.Second))
+	}
+	if step <= 0 {
+		return 0, fmt.Errorf("step must be positive")
+	}
+	return step, nil
+}
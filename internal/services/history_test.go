@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ypMetrics/internal/metrics"
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryHandler(t *testing.T) {
+	ctx := context.Background()
+	storage := store.NewHistoryStorage(metrics.NewMemStorage(), time.Hour)
+	require.NoError(t, storage.UpdateGauge(ctx, "HeapAlloc", 1))
+	require.NoError(t, storage.UpdateGauge(ctx, models.SeriesID("HeapAlloc", models.Labels{"host": "a"}), 5))
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, storage.UpdateGauge(ctx, "HeapAlloc", 2))
+
+	handler := NewHandler(storage)
+	router := mux.NewRouter()
+	router.HandleFunc("/history/{type}/{name}", handler.historyHandler).Methods(http.MethodGet)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, httptest.NewRequest(http.MethodGet, target, nil))
+		return record
+	}
+
+	record := get("/history/gauge/HeapAlloc")
+	require.Equal(t, http.StatusOK, record.Code, record.Body.String())
+	var response historyResponse
+	require.NoError(t, json.Unmarshal(record.Body.Bytes(), &response))
+	assert.Equal(t, "HeapAlloc", response.ID)
+	require.Len(t, response.Samples, 2)
+	assert.Equal(t, 1.0, response.Samples[0].Value)
+	assert.Equal(t, 2.0, response.Samples[1].Value)
+
+	record = get("/history/gauge/HeapAlloc?host=a&from=0")
+	require.Equal(t, http.StatusOK, record.Code, record.Body.String())
+	require.NoError(t, json.Unmarshal(record.Body.Bytes(), &response))
+	assert.Equal(t, models.Labels{"host": "a"}, response.Labels)
+	require.Len(t, response.Samples, 1)
+	assert.Equal(t, 5.0, response.Samples[0].Value)
+
+	tests := []struct {
+		target     string
+		statusCode int
+	}{
+		{"/history/gauge/Missing", http.StatusNotFound},
+		{"/history/gauge/HeapAlloc?from=yesterday", http.StatusBadRequest},
+		{"/history/gauge/HeapAlloc?from=2000&to=1000", http.StatusBadRequest},
+		{"/history/gauge/HeapAlloc?step=-1s", http.StatusBadRequest},
+		{"/history/gauge/HeapAlloc?from=0&step=1ms", http.StatusBadRequest},
+		{"/history/gauge/HeapAlloc?step=1m", http.StatusOK},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.statusCode, get(tt.target).Code, tt.target)
+	}
+}
+
+func TestHistoryHandlerDisabled(t *testing.T) {
+	handler := NewHandler(metrics.NewMemStorage())
+	request := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/history/gauge/HeapAlloc", nil),
+		map[string]string{"type": "gauge", "name": "HeapAlloc"})
+	record := httptest.NewRecorder()
+
+	handler.historyHandler(record, request)
+
+	assert.Equal(t, http.StatusNotImplemented, record.Code)
+}
+
+func TestHistoryHandlerWrapped(t *testing.T) {
+	ctx := context.Background()
+	// история не обязана быть внешней обёрткой
+	storage := store.NewStreamStorage(store.NewHistoryStorage(metrics.NewMemStorage(), time.Hour))
+	require.NoError(t, storage.UpdateGauge(ctx, "HeapAlloc", 1))
+
+	handler := NewHandler(storage)
+	request := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/history/gauge/HeapAlloc", nil),
+		map[string]string{"type": "gauge", "name": "HeapAlloc"})
+	record := httptest.NewRecorder()
+
+	handler.historyHandler(record, request)
+
+	require.Equal(t, http.StatusOK, record.Code, record.Body.String())
+	var response historyResponse
+	require.NoError(t, json.Unmarshal(record.Body.Bytes(), &response))
+	require.Len(t, response.Samples, 1)
+	assert.Equal(t, 1.0, response.Samples[0].Value)
+}
+
+func TestAlignSamples(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	samples := []store.Sample{
+		{Time: base.Add(10 * time.Second), Value: 1},
+		{Time: base.Add(20 * time.Second), Value: 2},
+		{Time: base.Add(70 * time.Second), Value: 3},
+	}
+
+	got := alignSamples(samples, base, base.Add(2*time.Minute), time.Minute)
+
+	assert.Equal(t, []store.Sample{
+		{Time: base.Add(time.Minute), Value: 2},
+		{Time: base.Add(2 * time.Minute), Value: 3},
+	}, got, "points before the first sample are skipped")
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ypMetrics/models"
+)
+
+// influxWriteHandler принимает InfluxDB line protocol. Каждое поле становится
+// отдельной метрикой "measurement.field", теги — её метками:
+// целые (с суффиксом i или u) — приращения счётчика, остальные числа — gauge.
+// Строки разбираются целиком до записи: одна битая строка отклоняет весь запрос.
+func (h *Handler) influxWriteHandler(w http.ResponseWriter, r *http.Request) {
+	var batch []models.Metrics
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		metrics, err := parseInfluxLine(line)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to parse line %d: %s", lineNum, err), http.StatusBadRequest)
+			return
+		}
+		batch = append(batch, metrics...)
+	}
+	if err := scanner.Err(); err != nil {
+		http.Error(w, fmt.Sprintf("failed to read body: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(batch) > 0 {
+		if err := h.storage.UpdateBatch(r.Context(), batch); err != nil {
+			writeStorageError(w, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseInfluxLine разбирает строку "measurement[,tag=v...] field=v[,field=v...] [timestamp]".
+// Метка времени не используется: сервер хранит только последнее значение.
+func parseInfluxLine(line string) ([]models.Metrics, error) {
+	sections := splitInflux(line, ' ')
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, errors.New("expected measurement, fields and optional timestamp")
+	}
+	if len(sections) == 3 {
+		if _, err := strconv.ParseInt(sections[2], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", sections[2])
+		}
+	}
+
+	series := splitInflux(sections[0], ',')
+	measurement := unescapeInflux(series[0])
+	if measurement == "" {
+		return nil, errors.New("missing measurement")
+	}
+
+	var labels models.Labels
+	for _, tag := range series[1:] {
+		key, value, ok := cutInflux(tag)
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid tag %q", tag)
+		}
+		if labels == nil {
+			labels = make(models.Labels)
+		}
+		labels[unescapeInflux(key)] = unescapeInflux(value)
+	}
+
+	var metrics []models.Metrics
+	for _, field := range splitInflux(sections[1], ',') {
+		key, raw, ok := cutInflux(field)
+		if !ok || key == "" || raw == "" {
+			return nil, fmt.Errorf("invalid field %q", field)
+		}
+		metric, skip, err := parseInfluxValue(measurement+"."+unescapeInflux(key), raw)
+		if err != nil {
+			return nil, err
+		}
+		if !skip {
+			metric.Labels = labels
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics, nil
+}
+
+func parseInfluxValue(id, raw string) (metric models.Metrics, skip bool, err error) {
+	metric.ID = id
+
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		// строковые поля хранить негде
+		return metric, true, nil
+	case strings.HasSuffix(raw, "i"), strings.HasSuffix(raw, "u"):
+		delta, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return metric, false, fmt.Errorf("invalid integer field %s=%s", id, raw)
+		}
+		metric.MType = models.Counter
+		metric.Delta = &delta
+		return metric, false, nil
+	}
+
+	var value float64
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		value = 1
+	case "f", "F", "false", "False", "FALSE":
+		value = 0
+	default:
+		value, err = strconv.ParseFloat(raw, 64)
+		if err != nil || models.ValidateValue(value) != nil {
+			return metric, false, fmt.Errorf("invalid float field %s=%s", id, raw)
+		}
+	}
+	metric.MType = models.Gauge
+	metric.Value = &value
+	return metric, false, nil
+}
+
+// splitInflux режет по sep, пропуская экранированные символы и строки в кавычках.
+func splitInflux(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// cutInflux делит "key=value" по первому неэкранированному '='.
+func cutInflux(s string) (key, value string, ok bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '=':
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+func unescapeInflux(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case ',', ' ', '=', '"', '\\':
+				i++
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
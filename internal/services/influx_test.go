@@ -0,0 +1,106 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ypMetrics/internal/metrics"
+	"ypMetrics/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInfluxLine(t *testing.T) {
+	gauge := func(id string, v float64) models.Metrics {
+		return models.Metrics{ID: id, MType: models.Gauge, Value: &v}
+	}
+	counter := func(id string, d int64) models.Metrics {
+		return models.Metrics{ID: id, MType: models.Counter, Delta: &d}
+	}
+	withLabels := func(m models.Metrics, labels models.Labels) models.Metrics {
+		m.Labels = labels
+		return m
+	}
+
+	tests := []struct {
+		name    string
+		line    string
+		want    []models.Metrics
+		wantErr bool
+	}{
+		{
+			name: "float field",
+			line: "cpu usage_idle=92.5",
+			want: []models.Metrics{gauge("cpu.usage_idle", 92.5)},
+		},
+		{
+			name: "tags become labels",
+			line: "cpu,region=eu,host=a usage_idle=92.5,requests=3i 1465839830100400200",
+			want: []models.Metrics{
+				withLabels(gauge("cpu.usage_idle", 92.5), models.Labels{"host": "a", "region": "eu"}),
+				withLabels(counter("cpu.requests", 3), models.Labels{"host": "a", "region": "eu"}),
+			},
+		},
+		{
+			name: "escaped characters",
+			line: `disk\ io,path=/var\,log read\=bytes=10u`,
+			want: []models.Metrics{withLabels(counter("disk io.read=bytes", 10), models.Labels{"path": "/var,log"})},
+		},
+		{
+			name: "strings are skipped, booleans become gauges",
+			line: `sensor status="ok, fine",online=t,temp=21`,
+			want: []models.Metrics{gauge("sensor.online", 1), gauge("sensor.temp", 21)},
+		},
+		{name: "missing fields", line: "cpu", wantErr: true},
+		{name: "bad timestamp", line: "cpu value=1 yesterday", wantErr: true},
+		{name: "bad integer", line: "cpu value=1.5i", wantErr: true},
+		{name: "NaN", line: "cpu value=NaN", wantErr: true},
+		{name: "infinity", line: "cpu value=-Inf", wantErr: true},
+		{name: "bad tag", line: "cpu,host value=1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseInfluxLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestInfluxWriteHandler(t *testing.T) {
+	storage := metrics.NewMemStorage()
+	handler := NewHandler(storage)
+
+	body := "# telegraf\nmem,host=a used=1024i,used_percent=12.5\nmem,host=a used=1024i 1465839830100400200\n"
+	request := httptest.NewRequest(http.MethodPost, "/write?db=telegraf", bytes.NewBufferString(body))
+	record := httptest.NewRecorder()
+
+	handler.influxWriteHandler(record, request)
+
+	assert.Equal(t, http.StatusNoContent, record.Code)
+	all, err := storage.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2048), all.Counters["mem.used,host=a"])
+	assert.Equal(t, 12.5, all.Gauges["mem.used_percent,host=a"])
+
+	request = httptest.NewRequest(http.MethodPost, "/write", bytes.NewBufferString("mem used=1i\nbroken line here\n"))
+	record = httptest.NewRecorder()
+
+	handler.influxWriteHandler(record, request)
+
+	assert.Equal(t, http.StatusBadRequest, record.Code)
+	assert.Contains(t, record.Body.String(), "line 2")
+	all, err = storage.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	_, found := all.Counters["mem.used"]
+	assert.False(t, found, "nothing must be written when a line is invalid")
+}
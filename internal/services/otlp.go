@@ -0,0 +1,361 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	otlpProtobufContentType = "application/x-protobuf"
+	otlpJSONContentType     = "application/json"
+	otlpMaxBodySize         = 8 << 20
+)
+
+// otlpMetricsHandler — приёмник OTLP/HTTP (POST /v1/metrics) в protobuf и JSON.
+// Gauge и немонотонные Sum ложатся в gauge, монотонные Sum — в counter.
+// Остальные типы (гистограммы, summary) пока отбрасываются и попадают
+// в partial_success ответа.
+func (h *Handler) otlpMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != otlpProtobufContentType && contentType != otlpJSONContentType {
+		http.Error(w, "Unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, otlpMaxBodySize))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	var request colmetricspb.ExportMetricsServiceRequest
+	if contentType == otlpProtobufContentType {
+		err = proto.Unmarshal(body, &request)
+	} else {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, &request)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid OTLP payload: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	export := h.cumulative.begin()
+	defer export.close()
+	batch, rejected, err := h.otlpToMetrics(r, &request, export)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	if len(batch) > 0 {
+		if err := h.storage.UpdateBatch(r.Context(), batch); err != nil {
+			writeStorageError(w, err)
+			return
+		}
+	}
+	export.commit()
+	export.close()
+
+	response := &colmetricspb.ExportMetricsServiceResponse{}
+	if rejected > 0 {
+		response.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: rejected,
+			ErrorMessage:       "only Gauge and Sum metrics are supported",
+		}
+	}
+
+	var out []byte
+	if contentType == otlpProtobufContentType {
+		out, err = proto.Marshal(response)
+	} else {
+		out, err = protojson.Marshal(response)
+	}
+	if err != nil {
+		http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
+
+func (h *Handler) otlpToMetrics(r *http.Request, request *colmetricspb.ExportMetricsServiceRequest, export *otlpExport) ([]models.Metrics, int64, error) {
+	var (
+		batch    []models.Metrics
+		rejected int64
+	)
+
+	for _, rm := range request.GetResourceMetrics() {
+		resource := rm.GetResource().GetAttributes()
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, metric := range sm.GetMetrics() {
+				switch data := metric.GetData().(type) {
+				case *metricspb.Metric_Gauge:
+					for _, dp := range data.Gauge.GetDataPoints() {
+						value, ok := numberValue(dp)
+						if !ok {
+							rejected++
+							continue
+						}
+						batch = append(batch, gaugeMetric(metric.GetName(), otlpLabels(resource, dp.GetAttributes()), value))
+					}
+				case *metricspb.Metric_Sum:
+					for _, dp := range data.Sum.GetDataPoints() {
+						m, err := h.sumToMetric(r, export, metric.GetName(), otlpLabels(resource, dp.GetAttributes()), data.Sum, dp)
+						if errors.Is(err, errSkipDataPoint) {
+							rejected++
+							continue
+						}
+						if err != nil {
+							return nil, 0, err
+						}
+						batch = append(batch, m)
+					}
+				case *metricspb.Metric_Histogram:
+					rejected += int64(len(data.Histogram.GetDataPoints()))
+				case *metricspb.Metric_ExponentialHistogram:
+					rejected += int64(len(data.ExponentialHistogram.GetDataPoints()))
+				case *metricspb.Metric_Summary:
+					rejected += int64(len(data.Summary.GetDataPoints()))
+				}
+			}
+		}
+	}
+	return batch, rejected, nil
+}
+
+var errSkipDataPoint = errors.New("data point skipped")
+
+// sumToMetric переводит точку Sum в метрику сервера. Наши счётчики хранят сумму
+// приращений, поэтому кумулятивное значение превращается в разницу с прошлой
+// точкой той же серии, см. otlpCumulative.
+func (h *Handler) sumToMetric(r *http.Request, export *otlpExport, name string, labels models.Labels, sum *metricspb.Sum, dp *metricspb.NumberDataPoint) (models.Metrics, error) {
+	id := models.SeriesID(name, labels)
+	value, ok := numberValue(dp)
+	if !ok {
+		return models.Metrics{}, errSkipDataPoint
+	}
+	cumulative := sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+
+	if !sum.GetIsMonotonic() {
+		if cumulative {
+			return gaugeMetric(name, labels, value), nil
+		}
+		current, err := h.storage.GetMetricsByTypeAndName(r.Context(), id, models.Gauge)
+		switch {
+		case err == nil:
+			value += *current.Value
+		case !errors.Is(err, store.ErrNotFound):
+			return models.Metrics{}, err
+		}
+		return gaugeMetric(name, labels, value), nil
+	}
+
+	delta := int64(math.Round(value))
+	if cumulative {
+		var err error
+		if delta, err = export.delta(r.Context(), h.storage, id, dp.GetStartTimeUnixNano(), value); err != nil {
+			return models.Metrics{}, err
+		}
+	}
+	return models.Metrics{ID: name, MType: models.Counter, Delta: &delta, Labels: labels}, nil
+}
+
+// otlpSeriesTTL — сколько помним серию без новых точек. Забытая серия
+// считается заново от суммы в хранилище, как после перезапуска сервера.
+const otlpSeriesTTL = time.Hour
+
+// otlpCumulative помнит последнее кумулятивное значение и время старта каждой
+// серии. Приращение считается от него, а не от суммы в хранилище: чтение
+// хранилища и запись пачки не атомарны, и параллельные экспорты считали бы
+// одно приращение дважды. Поэтому запросы с кумулятивными точками
+// выполняются по одному, от первой такой точки до записи пачки.
+type otlpCumulative struct {
+	startedAt uint64
+	now       func() time.Time
+	export    sync.Mutex
+	series    map[string]cumulativePoint
+	sweptAt   time.Time
+}
+
+type cumulativePoint struct {
+	start uint64
+	value float64
+	seen  time.Time
+}
+
+func newOTLPCumulative() *otlpCumulative {
+	now := time.Now()
+	return &otlpCumulative{
+		startedAt: uint64(now.UnixNano()),
+		now:       time.Now,
+		series:    make(map[string]cumulativePoint),
+		sweptAt:   now,
+	}
+}
+
+// begin начинает разбор одного запроса.
+func (c *otlpCumulative) begin() *otlpExport {
+	return &otlpExport{cumulative: c}
+}
+
+// expire забывает серии, по которым давно не было точек, но проходит
+// по всем сериям не чаще раза в otlpSeriesTTL.
+func (c *otlpCumulative) expire(now time.Time) {
+	if now.Sub(c.sweptAt) < otlpSeriesTTL {
+		return
+	}
+	for id, p := range c.series {
+		if now.Sub(p.seen) > otlpSeriesTTL {
+			delete(c.series, id)
+		}
+	}
+	c.sweptAt = now
+}
+
+// otlpExport — кумулятивные точки одного запроса. В otlpCumulative они
+// попадают только после успешной записи пачки: иначе повтор экспорта после
+// ошибки хранилища ничего бы не добавил.
+type otlpExport struct {
+	cumulative *otlpCumulative
+	locked     bool
+	pending    map[string]cumulativePoint
+}
+
+// delta возвращает приращение серии с прошлой точки. Сменившееся время старта
+// или уменьшившееся значение — перезапуск источника, и значение считается
+// целиком. Для первой точки серии прошлой точки нет: если источник стартовал
+// раньше сервера, часть значения могла быть учтена до нашего перезапуска,
+// поэтому приращение считается от суммы в хранилище, как раньше.
+// Округляются кумулятивные значения, а не разница: иначе дробный счётчик,
+// растущий на 0.4 за экспорт, никогда бы не сдвинулся.
+func (e *otlpExport) delta(ctx context.Context, storage store.Storage, id string, start uint64, value float64) (int64, error) {
+	c := e.cumulative
+	if !e.locked {
+		c.export.Lock()
+		e.locked = true
+	}
+
+	prev, ok := e.pending[id]
+	if !ok {
+		prev, ok = c.series[id]
+	}
+	var stored int64
+	if !ok && (start == 0 || start < c.startedAt) {
+		current, err := storage.GetMetricsByTypeAndName(ctx, id, models.Counter)
+		switch {
+		case err == nil:
+			stored = *current.Delta
+		case !errors.Is(err, store.ErrNotFound):
+			return 0, err
+		}
+	}
+
+	if e.pending == nil {
+		e.pending = make(map[string]cumulativePoint)
+	}
+	e.pending[id] = cumulativePoint{start: start, value: value}
+	rounded := int64(math.Round(value))
+	switch {
+	case !ok:
+		if rounded >= stored {
+			return rounded - stored, nil
+		}
+		return rounded, nil
+	case start != prev.start || value < prev.value:
+		return rounded, nil
+	default:
+		return rounded - int64(math.Round(prev.value)), nil
+	}
+}
+
+// commit запоминает точки запроса после записи пачки.
+func (e *otlpExport) commit() {
+	if !e.locked {
+		return
+	}
+	c := e.cumulative
+	now := c.now()
+	for id, p := range e.pending {
+		p.seen = now
+		c.series[id] = p
+	}
+	c.expire(now)
+}
+
+// close отпускает следующий запрос; незакоммиченные точки теряются.
+func (e *otlpExport) close() {
+	if e.locked {
+		e.cumulative.export.Unlock()
+		e.locked = false
+	}
+}
+
+func numberValue(dp *metricspb.NumberDataPoint) (float64, bool) {
+	switch v := dp.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsInt:
+		return float64(v.AsInt), true
+	case *metricspb.NumberDataPoint_AsDouble:
+		if math.IsNaN(v.AsDouble) || math.IsInf(v.AsDouble, 0) {
+			return 0, false
+		}
+		return v.AsDouble, true
+	}
+	return 0, false
+}
+
+func gaugeMetric(name string, labels models.Labels, value float64) models.Metrics {
+	return models.Metrics{ID: name, MType: models.Gauge, Value: &value, Labels: labels}
+}
+
+// otlpLabels переводит атрибуты ресурса (service.name, host.name) и точки
+// в метки, при совпадении ключей побеждает точка: без ресурса одинаковые
+// инструменты разных сервисов слились бы в одну серию. Пустые атрибуты
+// пропускаются: пустая метка означает её отсутствие.
+func otlpLabels(resource, point []*commonpb.KeyValue) models.Labels {
+	var labels models.Labels
+	for _, attributes := range [][]*commonpb.KeyValue{resource, point} {
+		for _, kv := range attributes {
+			value := anyValueString(kv.GetValue())
+			if kv.GetKey() == "" || value == "" {
+				continue
+			}
+			if labels == nil {
+				labels = make(models.Labels, len(resource)+len(point))
+			}
+			labels[kv.GetKey()] = value
+		}
+	}
+	return labels
+}
+
+func anyValueString(v *commonpb.AnyValue) string {
+	switch val := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return val.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(val.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(val.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(val.DoubleValue, 'g', -1, 64)
+	default:
+		return protojson.Format(v)
+	}
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"ypMetrics/internal/metrics"
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func otlpRequest(metrics ...*metricspb.Metric) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+		}},
+	}
+}
+
+func otlpSum(name string, monotonic bool, temporality metricspb.AggregationTemporality, value int64, attrs ...*commonpb.KeyValue) *metricspb.Metric {
+	return &metricspb.Metric{
+		Name: name,
+		Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			IsMonotonic:            monotonic,
+			AggregationTemporality: temporality,
+			DataPoints: []*metricspb.NumberDataPoint{{
+				Attributes: attrs,
+				Value:      &metricspb.NumberDataPoint_AsInt{AsInt: value},
+			}},
+		}},
+	}
+}
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func postOTLP(t *testing.T, handler Handler, request *colmetricspb.ExportMetricsServiceRequest) *colmetricspb.ExportMetricsServiceResponse {
+	t.Helper()
+	body, err := proto.Marshal(request)
+	require.NoError(t, err)
+
+	httpRequest := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(body))
+	httpRequest.Header.Set("Content-Type", otlpProtobufContentType)
+	record := httptest.NewRecorder()
+
+	handler.otlpMetricsHandler(record, httpRequest)
+
+	require.Equal(t, http.StatusOK, record.Code, record.Body.String())
+	var response colmetricspb.ExportMetricsServiceResponse
+	require.NoError(t, proto.Unmarshal(record.Body.Bytes(), &response))
+	return &response
+}
+
+func TestOTLPMetricsHandlerProtobuf(t *testing.T) {
+	ctx := context.Background()
+	storage := metrics.NewMemStorage()
+	handler := NewHandler(storage)
+
+	cumulative := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	delta := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+
+	request := otlpRequest(
+		&metricspb.Metric{
+			Name: "queue.size",
+			Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+				DataPoints: []*metricspb.NumberDataPoint{{
+					Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 12.5},
+				}},
+			}},
+		},
+		otlpSum("http.requests", true, cumulative, 10, stringAttr("route", "/api"), stringAttr("method", "GET")),
+		otlpSum("jobs.done", true, delta, 3),
+		otlpSum("connections", false, cumulative, 7),
+		&metricspb.Metric{
+			Name: "latency",
+			Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+				DataPoints: []*metricspb.HistogramDataPoint{{Count: 1}},
+			}},
+		},
+	)
+
+	response := postOTLP(t, handler, request)
+	assert.Equal(t, int64(1), response.GetPartialSuccess().GetRejectedDataPoints())
+
+	// второй экспорт: кумулятивный счётчик вырос до 15, дельта добавила ещё 3
+	request = otlpRequest(
+		otlpSum("http.requests", true, cumulative, 15, stringAttr("method", "GET"), stringAttr("route", "/api")),
+		otlpSum("jobs.done", true, delta, 3),
+	)
+	response = postOTLP(t, handler, request)
+	assert.Nil(t, response.GetPartialSuccess())
+
+	all, err := storage.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 12.5, all.Gauges["queue.size"])
+	assert.Equal(t, 7.0, all.Gauges["connections"])
+	assert.Equal(t, int64(15), all.Counters["http.requests,method=GET,route=/api"])
+	assert.Equal(t, int64(6), all.Counters["jobs.done"])
+}
+
+func TestOTLPMetricsHandlerResourceLabels(t *testing.T) {
+	storage := metrics.NewMemStorage()
+	handler := NewHandler(storage)
+
+	resourceRequest := func(service string, value int64) *colmetricspb.ExportMetricsServiceRequest {
+		request := otlpRequest(otlpSum("http.requests", true, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, value,
+			stringAttr("route", "/api"), stringAttr("host.name", "point")))
+		request.ResourceMetrics[0].Resource = &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+			stringAttr("service.name", service), stringAttr("host.name", "resource"),
+		}}
+		return request
+	}
+	postOTLP(t, handler, resourceRequest("api", 1))
+	postOTLP(t, handler, resourceRequest("worker", 2))
+
+	all, err := storage.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		"http.requests,host.name=point,route=/api,service.name=api":    1,
+		"http.requests,host.name=point,route=/api,service.name=worker": 2,
+	}, all.Counters)
+}
+
+func TestOTLPCumulativeToDelta(t *testing.T) {
+	cumulative := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	point := func(value int64, start uint64) *metricspb.Metric {
+		m := otlpSum("jobs", true, cumulative, value)
+		m.GetSum().DataPoints[0].StartTimeUnixNano = start
+		return m
+	}
+
+	tests := []struct {
+		name    string
+		exports [][]*metricspb.Metric
+		want    int64
+	}{
+		{
+			name:    "two points in one request",
+			exports: [][]*metricspb.Metric{{point(10, 1), point(15, 1)}},
+			want:    15,
+		},
+		{
+			name:    "repeated export",
+			exports: [][]*metricspb.Metric{{point(10, 1)}, {point(10, 1)}, {point(12, 1)}},
+			want:    12,
+		},
+		{
+			name:    "source restart",
+			exports: [][]*metricspb.Metric{{point(10, 1)}, {point(4, 2)}, {point(6, 2)}},
+			want:    16,
+		},
+		{
+			name:    "value drop without start time",
+			exports: [][]*metricspb.Metric{{point(10, 0)}, {point(3, 0)}},
+			want:    13,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := metrics.NewMemStorage()
+			handler := NewHandler(storage)
+			for _, export := range tt.exports {
+				postOTLP(t, handler, otlpRequest(export...))
+			}
+			all, err := storage.GetAllMetrics(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, all.Counters["jobs"])
+		})
+	}
+}
+
+func TestOTLPCumulativeFractional(t *testing.T) {
+	storage := metrics.NewMemStorage()
+	handler := NewHandler(storage)
+	cumulative := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+
+	// каждое приращение меньше 0.5, но сумма растёт
+	for _, value := range []float64{0.4, 0.8, 1.2, 1.6, 2.0, 2.4} {
+		m := otlpSum("cpu.seconds", true, cumulative, 0)
+		m.GetSum().DataPoints[0].Value = &metricspb.NumberDataPoint_AsDouble{AsDouble: value}
+		postOTLP(t, handler, otlpRequest(m))
+	}
+
+	all, err := storage.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), all.Counters["cpu.seconds"])
+}
+
+// failingBatches отказывает в записи пачек, пока fail выставлен.
+type failingBatches struct {
+	store.Storage
+	fail bool
+}
+
+func (s *failingBatches) UpdateBatch(ctx context.Context, metrics []models.Metrics) error {
+	if s.fail {
+		return errors.New("storage is down")
+	}
+	return s.Storage.UpdateBatch(ctx, metrics)
+}
+
+func TestOTLPCumulativeRetryAfterStorageFailure(t *testing.T) {
+	storage := &failingBatches{Storage: metrics.NewMemStorage()}
+	handler := NewHandler(storage)
+	cumulative := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+
+	postOTLP(t, handler, otlpRequest(otlpSum("jobs", true, cumulative, 10)))
+
+	storage.fail = true
+	body, err := proto.Marshal(otlpRequest(otlpSum("jobs", true, cumulative, 15)))
+	require.NoError(t, err)
+	request := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(body))
+	request.Header.Set("Content-Type", otlpProtobufContentType)
+	record := httptest.NewRecorder()
+	handler.otlpMetricsHandler(record, request)
+	require.Equal(t, http.StatusInternalServerError, record.Code)
+
+	// повтор того же экспорта доносит потерянное приращение
+	storage.fail = false
+	postOTLP(t, handler, otlpRequest(otlpSum("jobs", true, cumulative, 15)))
+
+	all, err := storage.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), all.Counters["jobs"])
+}
+
+func TestOTLPCumulativeExpiresSeries(t *testing.T) {
+	storage := metrics.NewMemStorage()
+	handler := NewHandler(storage)
+	now := time.Now()
+	handler.cumulative.now = func() time.Time { return now }
+	cumulative := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+
+	postOTLP(t, handler, otlpRequest(otlpSum("old", true, cumulative, 10)))
+	now = now.Add(otlpSeriesTTL / 2)
+	postOTLP(t, handler, otlpRequest(otlpSum("fresh", true, cumulative, 10)))
+	now = now.Add(otlpSeriesTTL)
+	postOTLP(t, handler, otlpRequest(otlpSum("fresh", true, cumulative, 12)))
+
+	assert.NotContains(t, handler.cumulative.series, "old")
+	assert.Contains(t, handler.cumulative.series, "fresh")
+
+	// забытая серия продолжается от суммы в хранилище
+	postOTLP(t, handler, otlpRequest(otlpSum("old", true, cumulative, 14)))
+	all, err := storage.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(14), all.Counters["old"])
+	assert.Equal(t, int64(12), all.Counters["fresh"])
+}
+
+func TestOTLPCumulativeConcurrentExports(t *testing.T) {
+	ctx := context.Background()
+	storage := metrics.NewMemStorage()
+	handler := NewHandler(storage)
+	cumulative := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+
+	postOTLP(t, handler, otlpRequest(otlpSum("jobs", true, cumulative, 10)))
+	// повторы одного экспорта параллельно не должны считаться дважды
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			postOTLP(t, handler, otlpRequest(otlpSum("jobs", true, cumulative, 15)))
+		}()
+	}
+	wg.Wait()
+
+	all, err := storage.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), all.Counters["jobs"])
+}
+
+func TestOTLPMetricsHandlerJSON(t *testing.T) {
+	storage := metrics.NewMemStorage()
+	handler := NewHandler(storage)
+
+	body := `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[{"name":"cpu.temp","gauge":{"dataPoints":[{"asDouble":61.5,"attributes":[{"key":"core","value":{"intValue":"2"}}]}]}}]}]}]}`
+	request := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewBufferString(body))
+	request.Header.Set("Content-Type", "application/json")
+	record := httptest.NewRecorder()
+
+	handler.otlpMetricsHandler(record, request)
+
+	require.Equal(t, http.StatusOK, record.Code, record.Body.String())
+	assert.Equal(t, "application/json", record.Header().Get("Content-Type"))
+	all, err := storage.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 61.5, all.Gauges["cpu.temp,core=2"])
+}
+
+func TestOTLPMetricsHandlerErrors(t *testing.T) {
+	handler := NewHandler(metrics.NewMemStorage())
+
+	request := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewBufferString("x"))
+	request.Header.Set("Content-Type", "text/plain")
+	record := httptest.NewRecorder()
+	handler.otlpMetricsHandler(record, request)
+	assert.Equal(t, http.StatusUnsupportedMediaType, record.Code)
+
+	request = httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewBufferString("{not json"))
+	request.Header.Set("Content-Type", "application/json")
+	record = httptest.NewRecorder()
+	handler.otlpMetricsHandler(record, request)
+	assert.Equal(t, http.StatusBadRequest, record.Code)
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+func (h *Handler) prometheusHandler(w http.ResponseWriter, r *http.Request) {
+	metrics, err := h.storage.GetAllMetrics(r.Context())
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	writePrometheus(&buf, metrics)
+
+	w.Header().Set("Content-Type", prometheusContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writePrometheus пишет снимок в текстовом формате Prometheus.
+// Имена сортируются, чтобы вывод был стабильным между скрейпами.
+func writePrometheus(w io.Writer, metrics store.Snapshot) {
+	var families []*promFamily
+	families = append(families, collectPrometheusFamilies(models.Gauge, metrics.Gauges, func(name string, labels models.Labels, v float64) []string {
+		return []string{name + formatPromLabels(labels) + " " + formatPromFloat(v)}
+	})...)
+	families = append(families, collectPrometheusFamilies(models.Counter, metrics.Counters, func(name string, labels models.Labels, v int64) []string {
+		return []string{name + formatPromLabels(labels) + " " + strconv.FormatInt(v, 10)}
+	})...)
+	families = append(families, collectPrometheusFamilies(models.Histogram, metrics.Histograms, func(name string, labels models.Labels, h store.HistogramState) []string {
+		data := h.Data()
+		samples := make([]string, 0, len(data.Buckets)+3)
+		for _, b := range data.Buckets {
+			le := `le="` + formatPromFloat(b.UpperBound) + `"`
+			samples = append(samples, fmt.Sprintf("%s_bucket%s %d", name, formatPromLabels(labels, le), b.Count))
+		}
+		return append(samples,
+			fmt.Sprintf("%s_bucket%s %d", name, formatPromLabels(labels, `le="+Inf"`), data.Count),
+			name+"_sum"+formatPromLabels(labels)+" "+formatPromFloat(data.Sum),
+			fmt.Sprintf("%s_count%s %d", name, formatPromLabels(labels), data.Count),
+		)
+	})...)
+	families = append(families, collectPrometheusFamilies(models.Summary, metrics.Summaries, func(name string, labels models.Labels, s store.SummaryState) []string {
+		data := s.Data()
+		samples := make([]string, 0, len(data.Quantiles)+2)
+		for _, q := range data.Quantiles {
+			quantile := `quantile="` + formatPromFloat(q.Quantile) + `"`
+			samples = append(samples, name+formatPromLabels(labels, quantile)+" "+formatPromFloat(q.Value))
+		}
+		return append(samples,
+			name+"_sum"+formatPromLabels(labels)+" "+formatPromFloat(data.Sum),
+			fmt.Sprintf("%s_count%s %d", name, formatPromLabels(labels), data.Count),
+		)
+	})...)
+
+	skipped := conflictingPrometheusFamilies(families)
+	for _, f := range families {
+		if skipped[f] {
+			continue
+		}
+		fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.mType)
+		for _, s := range f.series {
+			for _, sample := range s.samples {
+				fmt.Fprintln(w, sample)
+			}
+		}
+	}
+}
+
+// promFamily — серии одной метрики сервера под одним именем Prometheus.
+type promFamily struct {
+	name   string
+	source string
+	mType  string
+	series []promSeries
+}
+
+type promSeries struct {
+	key     string
+	samples []string
+}
+
+// sampleNames — имена, которые семейство занимает в выводе: у гистограммы
+// и summary это ещё и _bucket, _sum, _count.
+func (f *promFamily) sampleNames() []string {
+	switch f.mType {
+	case models.Histogram:
+		return []string{f.name, f.name + "_bucket", f.name + "_sum", f.name + "_count"}
+	case models.Summary:
+		return []string{f.name, f.name + "_sum", f.name + "_count"}
+	}
+	return []string{f.name}
+}
+
+// collectPrometheusFamilies собирает серии одной метрики вместе:
+// у каждого семейства должна быть ровно одна строка # TYPE.
+// Строки одной серии (корзины гистограммы) идут в том порядке, в каком их вернул format.
+func collectPrometheusFamilies[V any](mType string, series map[string]V, format func(name string, labels models.Labels, v V) []string) []*promFamily {
+	bySource := make(map[string]*promFamily)
+	for id, value := range series {
+		name, labels := models.ParseSeriesID(id)
+		labels = promLabels(labels, reservedPromLabel(mType))
+		f, ok := bySource[name]
+		if !ok {
+			f = &promFamily{name: sanitizeMetricName(name), source: name, mType: mType}
+			bySource[name] = f
+		}
+		f.series = append(f.series, promSeries{
+			key:     formatPromLabels(labels),
+			samples: format(f.name, labels, value),
+		})
+	}
+
+	families := make([]*promFamily, 0, len(bySource))
+	for _, source := range sortedKeys(bySource) {
+		f := bySource[source]
+		sort.Slice(f.series, func(i, j int) bool { return f.series[i].key < f.series[j].key })
+		families = append(families, f)
+	}
+	sort.SliceStable(families, func(i, j int) bool { return families[i].name < families[j].name })
+	return families
+}
+
+// conflictingPrometheusFamilies находит семейства, чьи имена после приведения
+// совпали с уже занятыми: gauge и counter с одним именем, "a.b" и "a-b",
+// gauge "x_sum" рядом с гистограммой "x". Prometheus отвергает весь скрейп
+// с повторами, поэтому выводится только первое семейство по имени, типу
+// и исходному имени, а остальные пропускаются с предупреждением в логе.
+func conflictingPrometheusFamilies(families []*promFamily) map[*promFamily]bool {
+	ordered := make([]*promFamily, len(families))
+	copy(ordered, families)
+	// families уже идут по типам, внутри типа — по имени
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].name < ordered[j].name })
+
+	owners := make(map[string]*promFamily)
+	skipped := make(map[*promFamily]bool)
+	for _, f := range ordered {
+		var owner *promFamily
+		for _, name := range f.sampleNames() {
+			if owner = owners[name]; owner != nil {
+				break
+			}
+		}
+		if owner != nil {
+			log.Printf("Skipping %s %s in Prometheus output: name %s is taken by %s %s",
+				f.mType, f.source, f.name, owner.mType, owner.source)
+			skipped[f] = true
+			continue
+		}
+		for _, name := range f.sampleNames() {
+			owners[name] = f
+		}
+	}
+	return skipped
+}
+
+func formatPromFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// reservedPromLabel — метка, которую вывод добавляет к сериям типа сам.
+func reservedPromLabel(mType string) string {
+	switch mType {
+	case models.Histogram:
+		return "le"
+	case models.Summary:
+		return "quantile"
+	}
+	return ""
+}
+
+// promLabels приводит имена меток к формату Prometheus. Prometheus отвергает
+// весь скрейп, если имя метки повторяется, поэтому имя, совпавшее после
+// приведения с другой меткой или с reserved, получает приставку exported_,
+// как при honor_labels: false. Имена, которые не пришлось менять, выбирают первыми.
+func promLabels(labels models.Labels, reserved string) models.Labels {
+	if len(labels) == 0 {
+		return labels
+	}
+	taken := map[string]bool{reserved: reserved != ""}
+	out := make(models.Labels, len(labels))
+	keys := sortedKeys(labels)
+	for _, valid := range []bool{true, false} {
+		for _, k := range keys {
+			// в именах меток, в отличие от имён метрик, двоеточие запрещено
+			key := strings.ReplaceAll(sanitizeMetricName(k), ":", "_")
+			if (key == k) != valid {
+				continue
+			}
+			for taken[key] {
+				key = "exported_" + key
+			}
+			taken[key] = true
+			out[key] = labels[k]
+		}
+	}
+	return out
+}
+
+// formatPromLabels выводит метки серии, уже приведённые promLabels;
+// extra — готовые пары вроде le="0.5", они идут последними.
+func formatPromLabels(labels models.Labels, extra ...string) string {
+	if len(labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)+len(extra))
+	for k, v := range labels {
+		pairs = append(pairs, k+`="`+promLabelEscaper.Replace(v)+`"`)
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(append(pairs, extra...), ",") + "}"
+}
+
+// sanitizeMetricName приводит имя к [a-zA-Z_:][a-zA-Z0-9_:]*,
+// заменяя всё лишнее на подчёркивание.
+func sanitizeMetricName(name string) string {
+	if name == "" {
+		return "_"
+	}
+	out := []byte(name)
+	for i, c := range out {
+		valid := c == '_' || c == ':' ||
+			(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+			(i > 0 && c >= '0' && c <= '9')
+		if !valid {
+			out[i] = '_'
+		}
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		return "_" + name[:1] + string(out[1:])
+	}
+	return string(out)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
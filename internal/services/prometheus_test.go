@@ -0,0 +1,217 @@
+package services
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeMetricName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"HeapAlloc", "HeapAlloc"},
+		{"http.requests-total", "http_requests_total"},
+		{"node:cpu_seconds", "node:cpu_seconds"},
+		{"9lives", "_9lives"},
+		{"temp°C", "temp__C"},
+		{"", "_"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, sanitizeMetricName(tt.name), tt.name)
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	var buf bytes.Buffer
+	writePrometheus(&buf, store.Snapshot{
+		Gauges: map[string]float64{
+			"RandomValue": 0.25,
+			"Alloc":       1.5e+06,
+			"Broken":      math.Inf(1),
+		},
+		Counters: map[string]int64{
+			"PollCount": 42,
+		},
+	})
+
+	want := `# TYPE Alloc gauge
+Alloc 1.5e+06
+# TYPE Broken gauge
+Broken +Inf
+# TYPE RandomValue gauge
+RandomValue 0.25
+# TYPE PollCount counter
+PollCount 42
+`
+	assert.Equal(t, want, buf.String())
+}
+
+func TestWritePrometheusLabels(t *testing.T) {
+	var buf bytes.Buffer
+	writePrometheus(&buf, store.Snapshot{
+		Gauges: map[string]float64{
+			models.SeriesID("Alloc", models.Labels{"host": "b"}):                 2,
+			models.SeriesID("Alloc", models.Labels{"host": "a", "region": "eu"}): 1,
+			"Alloc": 3,
+			models.SeriesID("cpu.temp", models.Labels{"dc:room": `r"1`}): 40,
+		},
+	})
+
+	want := `# TYPE Alloc gauge
+Alloc 3
+Alloc{host="a",region="eu"} 1
+Alloc{host="b"} 2
+# TYPE cpu_temp gauge
+cpu_temp{dc_room="r\"1"} 40
+`
+	assert.Equal(t, want, buf.String())
+}
+
+func TestWritePrometheusDistributions(t *testing.T) {
+	histogram := store.NewHistogramState([]float64{0.5, 1})
+	histogram.Observe(0.25)
+	histogram.Observe(2)
+	summary := store.NewSummaryState([]float64{0.5})
+	summary.Observe(3)
+
+	var buf bytes.Buffer
+	writePrometheus(&buf, store.Snapshot{
+		Histograms: map[string]store.HistogramState{
+			models.SeriesID("http.latency", models.Labels{"route": "/"}): *histogram,
+		},
+		Summaries: map[string]store.SummaryState{"rt": *summary},
+	})
+
+	want := `# TYPE http_latency histogram
+http_latency_bucket{route="/",le="0.5"} 1
+http_latency_bucket{route="/",le="1"} 1
+http_latency_bucket{route="/",le="+Inf"} 2
+http_latency_sum{route="/"} 2.25
+http_latency_count{route="/"} 2
+# TYPE rt summary
+rt{quantile="0.5"} 3
+rt_sum 3
+rt_count 1
+`
+	assert.Equal(t, want, buf.String())
+}
+
+func TestWritePrometheusConflicts(t *testing.T) {
+	histogram := store.NewHistogramState([]float64{1})
+	histogram.Observe(0.5)
+
+	var buf bytes.Buffer
+	writePrometheus(&buf, store.Snapshot{
+		Gauges: map[string]float64{
+			"dup":     1,
+			"a.b":     2,
+			"a-b":     3,
+			"rt_sum":  4,
+			"rt_sums": 5,
+		},
+		Counters:   map[string]int64{"dup": 6},
+		Histograms: map[string]store.HistogramState{"rt": *histogram},
+	})
+
+	want := `# TYPE a_b gauge
+a_b 3
+# TYPE dup gauge
+dup 1
+# TYPE rt_sums gauge
+rt_sums 5
+# TYPE rt histogram
+rt_bucket{le="1"} 1
+rt_bucket{le="+Inf"} 1
+rt_sum 0.5
+rt_count 1
+`
+	assert.Equal(t, want, buf.String(), "every name has a single family")
+}
+
+func TestWritePrometheusLabelConflicts(t *testing.T) {
+	histogram := store.NewHistogramState([]float64{1})
+	histogram.Observe(0.5)
+	summary := store.NewSummaryState([]float64{0.5})
+	summary.Observe(2)
+
+	tests := []struct {
+		name     string
+		snapshot store.Snapshot
+		want     string
+	}{
+		{
+			name: "same name after sanitizing",
+			snapshot: store.Snapshot{Gauges: map[string]float64{
+				models.SeriesID("g", models.Labels{"a.b": "1", "a-b": "2", "a_b": "3"}): 1,
+			}},
+			want: `# TYPE g gauge
+g{a_b="3",exported_a_b="2",exported_exported_a_b="1"} 1
+`,
+		},
+		{
+			name: "le on histogram",
+			snapshot: store.Snapshot{Histograms: map[string]store.HistogramState{
+				models.SeriesID("rt", models.Labels{"le": "user"}): *histogram,
+			}},
+			want: `# TYPE rt histogram
+rt_bucket{exported_le="user",le="1"} 1
+rt_bucket{exported_le="user",le="+Inf"} 1
+rt_sum{exported_le="user"} 0.5
+rt_count{exported_le="user"} 1
+`,
+		},
+		{
+			name: "quantile on summary",
+			snapshot: store.Snapshot{Summaries: map[string]store.SummaryState{
+				models.SeriesID("lat", models.Labels{"quantile": "user"}): *summary,
+			}},
+			want: `# TYPE lat summary
+lat{exported_quantile="user",quantile="0.5"} 2
+lat_sum{exported_quantile="user"} 2
+lat_count{exported_quantile="user"} 1
+`,
+		},
+		{
+			name: "le on gauge is kept",
+			snapshot: store.Snapshot{Gauges: map[string]float64{
+				models.SeriesID("g", models.Labels{"le": "user"}): 1,
+			}},
+			want: `# TYPE g gauge
+g{le="user"} 1
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writePrometheus(&buf, tt.snapshot)
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	mock := &MockStorage{}
+	mock.GetAllMetricsFunc = func() (store.Snapshot, error) {
+		return store.Snapshot{Counters: map[string]int64{"PollCount": 3}}, nil
+	}
+	handler := NewHandler(mock)
+
+	request, _ := http.NewRequest(http.MethodGet, "/prometheus", nil)
+	record := httptest.NewRecorder()
+
+	handler.prometheusHandler(record, request)
+
+	assert.Equal(t, http.StatusOK, record.Code)
+	assert.Equal(t, prometheusContentType, record.Header().Get("Content-Type"))
+	assert.Equal(t, "# TYPE PollCount counter\nPollCount 3\n", record.Body.String())
+}
@@ -1,44 +1,156 @@
 package services
 
 import (
-	"flag"
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"time"
 
-	"ypMetrics/internal/helper"
+	"ypMetrics/internal/alerts"
+	"ypMetrics/internal/misc"
 	"ypMetrics/internal/store"
 
 	"github.com/gorilla/mux"
-	"github.com/spf13/viper"
 )
 
-func NewMetricServer(storage store.Storage) error{
-	viper.AutomaticEnv() 
-    var serverAddress string
-    envAddress := viper.GetString("ADDRESS") 
-	flag.StringVar(&serverAddress, "a", "localhost:8080", "server adress")
+func NewMetricServer(ctx context.Context, cfg misc.ServerConfig, storage store.Storage) error{
+	handlers := NewHandler(storage)
+	handlers.done = ctx.Done()
 
-	flag.Parse()
+	if cfg.AlertRulesPath != "" {
+		if cfg.AlertInterval <= 0 {
+			return fmt.Errorf("alert interval must be positive, got %s", cfg.AlertInterval)
+		}
+		rules, err := alerts.LoadRules(cfg.AlertRulesPath)
+		if err != nil {
+			return err
+		}
+		handlers.alerts = alerts.NewEngine(storage, rules)
 
-	helper.AssignIfNotEmpty(&serverAddress,envAddress)
+		state, ok := store.As[store.StateStore](storage)
+		if !ok {
+			log.Printf("Storage cannot persist silences, they will be kept in memory")
+		}
+		if handlers.silences, err = alerts.NewSilences(ctx, state); err != nil {
+			return err
+		}
 
-	handlers := &Handler{storage: storage}
+		receivers, err := alertReceivers(cfg)
+		if err != nil {
+			return err
+		}
+		if len(receivers) > 0 {
+			dispatcher := alerts.NewDispatcher(receivers, cfg.AlertGroupBy, cfg.AlertGroupWait, cfg.AlertRepeatInterval,
+				alerts.NewDeadLetterLog(cfg.AlertDeadLetterPath), handlers.silences)
+			handlers.alerts.OnChange(dispatcher.Add)
+			go dispatcher.Run(ctx)
+			fmt.Printf("Sending alert notifications to %d receivers\n", len(receivers))
+		}
+		go handlers.alerts.Run(ctx, cfg.AlertInterval)
+		fmt.Printf("Evaluating %d alert rules every %s\n", len(rules), cfg.AlertInterval)
+	}
 
-	router := mux.NewRouter()
-	fmt.Printf("Starting server on %s\n",serverAddress)
+	fmt.Printf("Starting server on %s\n", cfg.Address)
+	router := newRouter(&handlers, cfg.Key)
 
-	router.HandleFunc("/update/{type}/{value}", handlers.errorHandler).Methods(http.MethodPost)
-	router.HandleFunc("/update/{type}/{name}/{value}", handlers.updateHandler).Methods(http.MethodPost)
-	
-	router.HandleFunc("/value/{type}/{name}", handlers.getMetricHandler).Methods(http.MethodGet)
+	if cfg.StatsDAddress != "" {
+		addr, err := ListenStatsD(ctx, cfg.StatsDAddress, storage)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Listening for StatsD on %s\n", addr)
+	}
 
-	router.HandleFunc("/metrics", handlers.metricsHandler).Methods(http.MethodPost)
-	
-	router.HandleFunc("/", handlers.metricsHTMLHandler).Methods(http.MethodGet)
+	if cfg.GraphiteAddress != "" {
+		addr, err := ListenGraphite(ctx, cfg.GraphiteAddress, storage)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Listening for Graphite on %s\n", addr)
+	}
+
+	if cfg.GRPCAddress != "" {
+		addr, err := ListenGRPC(ctx, cfg.GRPCAddress, storage, cfg.Key)
+		if err != nil {
+			return fmt.Errorf("grpc listen error: %w", err)
+		}
+		fmt.Printf("Starting gRPC server on %s\n", addr)
+	}
+
+	server := &http.Server{Addr: cfg.Address, Handler: router}
 
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
 
-	if err := http.ListenAndServe(serverAddress, router); err != nil {
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("server error: %v", err)
 	}
 	return nil
 }
+
+func alertReceivers(cfg misc.ServerConfig) ([]alerts.Receiver, error) {
+	var receivers []alerts.Receiver
+	for _, url := range cfg.AlertWebhooks {
+		receivers = append(receivers, alerts.NewWebhookReceiver(url))
+	}
+	if cfg.SMTPAddress != "" {
+		if cfg.SMTPFrom == "" || len(cfg.SMTPTo) == 0 {
+			return nil, fmt.Errorf("alert emails need both sender and recipients")
+		}
+		receivers = append(receivers, alerts.NewSMTPReceiver(cfg.SMTPAddress, cfg.SMTPFrom, cfg.SMTPTo, cfg.SMTPUsername, cfg.SMTPPassword))
+	}
+	return receivers, nil
+}
+
+// newRouter собирает маршруты HTTP API. С ключом все запросы, кроме
+// приёмников внешних протоколов, проходят проверку подписи.
+func newRouter(handlers *Handler, key string) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(gzipMiddleware)
+
+	// Telegraf и OTel-экспортёры не умеют ставить HashSHA256,
+	// поэтому приёмники их протоколов не требуют подписи
+	router.HandleFunc("/write", handlers.influxWriteHandler).Methods(http.MethodPost)
+	router.HandleFunc("/v1/metrics", handlers.otlpMetricsHandler).Methods(http.MethodPost)
+
+	api := router.PathPrefix("/").Subrouter()
+	if key != "" {
+		api.Use(hashMiddleware(key))
+	}
+
+	api.HandleFunc("/update/{type}/{value}", handlers.errorHandler).Methods(http.MethodPost)
+	api.HandleFunc("/update/{type}/{name}/{value}", handlers.updateHandler).Methods(http.MethodPost)
+	api.HandleFunc("/update/", handlers.updateJSONHandler).Methods(http.MethodPost)
+	api.HandleFunc("/updates/", handlers.updatesHandler).Methods(http.MethodPost)
+	
+	api.HandleFunc("/value/{type}/{name}", handlers.getMetricHandler).Methods(http.MethodGet)
+	api.HandleFunc("/value/", handlers.getMetricJSONHandler).Methods(http.MethodPost)
+
+	api.HandleFunc("/value/{type}/{name}", handlers.deleteMetricHandler).Methods(http.MethodDelete)
+	api.HandleFunc("/values/", handlers.deleteByPrefixHandler).Methods(http.MethodDelete)
+	api.HandleFunc("/reset/counter/{name}", handlers.resetCounterHandler).Methods(http.MethodPost)
+
+	api.HandleFunc("/history/{type}/{name}", handlers.historyHandler).Methods(http.MethodGet)
+	api.HandleFunc("/stream", handlers.streamHandler).Methods(http.MethodGet)
+	api.HandleFunc("/ws", handlers.websocketHandler).Methods(http.MethodGet)
+
+	api.HandleFunc("/alerts", handlers.alertsHandler).Methods(http.MethodGet)
+	api.HandleFunc("/silences", handlers.listSilencesHandler).Methods(http.MethodGet)
+	api.HandleFunc("/silences", handlers.createSilenceHandler).Methods(http.MethodPost)
+	api.HandleFunc("/silences/{id}", handlers.deleteSilenceHandler).Methods(http.MethodDelete)
+
+	api.HandleFunc("/metrics", handlers.metricsHandler).Methods(http.MethodPost)
+
+	api.HandleFunc("/ping", handlers.pingHandler).Methods(http.MethodGet)
+	api.HandleFunc("/prometheus", handlers.prometheusHandler).Methods(http.MethodGet)
+
+	api.HandleFunc("/", handlers.metricsHTMLHandler).Methods(http.MethodGet)
+
+	return router
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"ypMetrics/internal/alerts"
+	"ypMetrics/models"
+
+	"github.com/gorilla/mux"
+)
+
+// silenceRequest — тело POST /silences. Конец задаётся либо endsAt,
+// либо duration ("2h", "30m") от startsAt; без startsAt тишина начинается сразу.
+type silenceRequest struct {
+	Metric    string        `json:"metric"`
+	Labels    models.Labels `json:"labels"`
+	StartsAt  time.Time     `json:"startsAt"`
+	EndsAt    time.Time     `json:"endsAt"`
+	Duration  string        `json:"duration"`
+	CreatedBy string        `json:"createdBy"`
+	Comment   string        `json:"comment"`
+}
+
+func (h *Handler) createSilenceHandler(w http.ResponseWriter, r *http.Request) {
+	if h.silences == nil {
+		http.Error(w, "Alerting is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	var req silenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	silence := alerts.Silence{
+		Metric:    req.Metric,
+		Labels:    req.Labels,
+		StartsAt:  req.StartsAt,
+		EndsAt:    req.EndsAt,
+		CreatedBy: req.CreatedBy,
+		Comment:   req.Comment,
+	}
+	if req.Duration != "" {
+		if !req.EndsAt.IsZero() {
+			http.Error(w, "Use either endsAt or duration", http.StatusBadRequest)
+			return
+		}
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid duration '%s'", req.Duration), http.StatusBadRequest)
+			return
+		}
+		if silence.StartsAt.IsZero() {
+			silence.StartsAt = time.Now()
+		}
+		silence.EndsAt = silence.StartsAt.Add(duration)
+	}
+
+	created, err := h.silences.Add(r.Context(), silence)
+	if err != nil {
+		writeSilenceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) listSilencesHandler(w http.ResponseWriter, r *http.Request) {
+	if h.silences == nil {
+		http.Error(w, "Alerting is disabled", http.StatusNotImplemented)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.silences.List())
+}
+
+func (h *Handler) deleteSilenceHandler(w http.ResponseWriter, r *http.Request) {
+	if h.silences == nil {
+		http.Error(w, "Alerting is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if err := h.silences.Delete(r.Context(), id); err != nil {
+		writeSilenceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Silence %s deleted", id)
+}
+
+func writeSilenceError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, alerts.ErrInvalidSilence):
+		status = http.StatusBadRequest
+	case errors.Is(err, alerts.ErrSilenceNotFound):
+		status = http.StatusNotFound
+	}
+	http.Error(w, fmt.Sprintf("ERROR Handler: %s", err), status)
+}
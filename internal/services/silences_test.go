@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ypMetrics/internal/alerts"
+	"ypMetrics/internal/metrics"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSilencesRouter(t *testing.T) (*mux.Router, *alerts.Silences) {
+	t.Helper()
+	silences, err := alerts.NewSilences(context.Background(), nil)
+	require.NoError(t, err)
+	handler := &Handler{storage: metrics.NewMemStorage(), silences: silences}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/silences", handler.listSilencesHandler).Methods(http.MethodGet)
+	router.HandleFunc("/silences", handler.createSilenceHandler).Methods(http.MethodPost)
+	router.HandleFunc("/silences/{id}", handler.deleteSilenceHandler).Methods(http.MethodDelete)
+	return router, silences
+}
+
+func TestCreateSilenceHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+		wantLength time.Duration
+	}{
+		{
+			name:       "duration",
+			body:       `{"metric":"PollCount","duration":"30m","createdBy":"ci","comment":"deploy"}`,
+			statusCode: http.StatusCreated,
+			wantLength: 30 * time.Minute,
+		},
+		{
+			name:       "window",
+			body:       `{"labels":{"host":"a"},"startsAt":"2999-01-01T00:00:00Z","endsAt":"2999-01-01T02:00:00Z"}`,
+			statusCode: http.StatusCreated,
+			wantLength: 2 * time.Hour,
+		},
+		{name: "no matcher", body: `{"duration":"1h"}`, statusCode: http.StatusBadRequest},
+		{name: "no end", body: `{"metric":"PollCount"}`, statusCode: http.StatusBadRequest},
+		{name: "both end and duration", body: `{"metric":"PollCount","duration":"1h","endsAt":"2999-01-01T00:00:00Z"}`, statusCode: http.StatusBadRequest},
+		{name: "bad duration", body: `{"metric":"PollCount","duration":"-1h"}`, statusCode: http.StatusBadRequest},
+		{name: "already ended", body: `{"metric":"PollCount","startsAt":"2000-01-01T00:00:00Z","endsAt":"2000-01-01T01:00:00Z"}`, statusCode: http.StatusBadRequest},
+		{name: "invalid json", body: `{`, statusCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, silences := newSilencesRouter(t)
+			record := httptest.NewRecorder()
+			router.ServeHTTP(record, httptest.NewRequest(http.MethodPost, "/silences", strings.NewReader(tt.body)))
+
+			require.Equal(t, tt.statusCode, record.Code, record.Body.String())
+			if tt.statusCode != http.StatusCreated {
+				assert.Empty(t, silences.List())
+				return
+			}
+			var created alerts.Silence
+			require.NoError(t, json.Unmarshal(record.Body.Bytes(), &created))
+			assert.NotEmpty(t, created.ID)
+			assert.Equal(t, tt.wantLength, created.EndsAt.Sub(created.StartsAt))
+			require.Len(t, silences.List(), 1)
+			assert.Equal(t, created.ID, silences.List()[0].ID)
+		})
+	}
+}
+
+func TestListAndDeleteSilenceHandlers(t *testing.T) {
+	router, silences := newSilencesRouter(t)
+	silence, err := silences.Add(context.Background(), alerts.Silence{Metric: "PollCount", EndsAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	record := httptest.NewRecorder()
+	router.ServeHTTP(record, httptest.NewRequest(http.MethodGet, "/silences", nil))
+	require.Equal(t, http.StatusOK, record.Code)
+	var list []alerts.Silence
+	require.NoError(t, json.Unmarshal(record.Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	assert.Equal(t, silence.ID, list[0].ID)
+
+	record = httptest.NewRecorder()
+	router.ServeHTTP(record, httptest.NewRequest(http.MethodDelete, "/silences/"+silence.ID, nil))
+	assert.Equal(t, http.StatusOK, record.Code)
+	assert.Empty(t, silences.List())
+
+	record = httptest.NewRecorder()
+	router.ServeHTTP(record, httptest.NewRequest(http.MethodDelete, "/silences/"+silence.ID, nil))
+	assert.Equal(t, http.StatusNotFound, record.Code)
+}
+
+func TestSilenceHandlersDisabled(t *testing.T) {
+	handler := NewHandler(metrics.NewMemStorage())
+
+	record := httptest.NewRecorder()
+	handler.createSilenceHandler(record, httptest.NewRequest(http.MethodPost, "/silences", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusNotImplemented, record.Code)
+
+	record = httptest.NewRecorder()
+	handler.listSilencesHandler(record, httptest.NewRequest(http.MethodGet, "/silences", nil))
+	assert.Equal(t, http.StatusNotImplemented, record.Code)
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+)
+
+// UDP-пакет StatsD не бывает больше этого на практике
+const statsdMaxPacket = 65535
+
+var errUnsupportedStatsDType = errors.New("unsupported statsd metric type")
+
+type statsdMetric struct {
+	name     string
+	mType    string
+	value    float64
+	relative bool // "+N" или "-N" у gauge — изменение, а не новое значение
+	rate     float64
+}
+
+// ListenStatsD открывает UDP-порт и пишет пришедшие строки StatsD в storage,
+// пока не отменён ctx. Ошибка возвращается только если порт не удалось открыть.
+func ListenStatsD(ctx context.Context, addr string, storage store.Storage) (net.Addr, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd listen error: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	go func() {
+		buf := make([]byte, statsdMaxPacket)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Error reading statsd packet: %v", err)
+					continue
+				}
+				return
+			}
+			handleStatsDPacket(ctx, storage, string(buf[:n]))
+		}
+	}()
+
+	return conn.LocalAddr(), nil
+}
+
+func handleStatsDPacket(ctx context.Context, storage store.Storage, packet string) {
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		m, err := parseStatsDLine(line)
+		if err != nil {
+			log.Printf("Error parsing statsd line %q: %v", line, err)
+			continue
+		}
+		if err := applyStatsDMetric(ctx, storage, m); err != nil {
+			log.Printf("Error storing statsd metric %s: %v", m.name, err)
+		}
+	}
+}
+
+// parseStatsDLine разбирает строку вида name:value|type[|@rate].
+func parseStatsDLine(line string) (statsdMetric, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return statsdMetric{}, errors.New("missing metric name")
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return statsdMetric{}, errors.New("missing metric type")
+	}
+
+	m := statsdMetric{name: name, rate: 1}
+
+	rawValue := parts[0]
+	value, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil || models.ValidateValue(value) != nil {
+		return statsdMetric{}, fmt.Errorf("invalid value %q", rawValue)
+	}
+	m.value = value
+
+	switch parts[1] {
+	case "c":
+		m.mType = models.Counter
+	case "g":
+		m.mType = models.Gauge
+		m.relative = strings.HasPrefix(rawValue, "+") || strings.HasPrefix(rawValue, "-")
+	default:
+		return statsdMetric{}, fmt.Errorf("%w %q", errUnsupportedStatsDType, parts[1])
+	}
+
+	for _, opt := range parts[2:] {
+		if !strings.HasPrefix(opt, "@") {
+			continue
+		}
+		rate, err := strconv.ParseFloat(opt[1:], 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return statsdMetric{}, fmt.Errorf("invalid sample rate %q", opt)
+		}
+		m.rate = rate
+	}
+
+	return m, nil
+}
+
+func applyStatsDMetric(ctx context.Context, storage store.Storage, m statsdMetric) error {
+	// ключ строится так же, как в HTTP: запятая в имени не должна читаться как метки
+	id := models.SeriesID(m.name, nil)
+	switch m.mType {
+	case models.Counter:
+		// при семплировании пришла только часть событий — восстанавливаем полное число
+		delta := int64(math.Round(m.value / m.rate))
+		_, err := storage.UpdateCounter(ctx, id, delta)
+		return err
+	case models.Gauge:
+		value := m.value
+		if m.relative {
+			current, err := storage.GetMetricsByTypeAndName(ctx, id, models.Gauge)
+			switch {
+			case err == nil:
+				value += *current.Value
+			case !errors.Is(err, store.ErrNotFound):
+				return err
+			}
+		}
+		return storage.UpdateGauge(ctx, id, value)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"ypMetrics/internal/metrics"
+	"ypMetrics/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatsDLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    statsdMetric
+		wantErr bool
+	}{
+		{line: "requests:1|c", want: statsdMetric{name: "requests", mType: models.Counter, value: 1, rate: 1}},
+		{line: "requests:3|c|@0.1", want: statsdMetric{name: "requests", mType: models.Counter, value: 3, rate: 0.1}},
+		{line: "temperature:3.2|g", want: statsdMetric{name: "temperature", mType: models.Gauge, value: 3.2, rate: 1}},
+		{line: "temperature:+4|g", want: statsdMetric{name: "temperature", mType: models.Gauge, value: 4, relative: true, rate: 1}},
+		{line: "temperature:-1.5|g", want: statsdMetric{name: "temperature", mType: models.Gauge, value: -1.5, relative: true, rate: 1}},
+		{line: "latency:320|ms", wantErr: true},
+		{line: "requests:abc|c", wantErr: true},
+		{line: "temperature:NaN|g", wantErr: true},
+		{line: "temperature:+Inf|g", wantErr: true},
+		{line: "requests:-Inf|c", wantErr: true},
+		{line: "requests:1|c|@0", wantErr: true},
+		{line: "requests", wantErr: true},
+		{line: ":1|c", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := parseStatsDLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHandleStatsDPacket(t *testing.T) {
+	ctx := context.Background()
+	storage := metrics.NewMemStorage()
+
+	handleStatsDPacket(ctx, storage, "requests:1|c\nrequests:2|c|@0.5\ntemperature:10|g\ntemperature:-2.5|g\nbroken\n")
+
+	all, err := storage.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), all.Counters["requests"])
+	assert.Equal(t, 7.5, all.Gauges["temperature"])
+}
+
+func TestHandleStatsDPacketEscapesName(t *testing.T) {
+	ctx := context.Background()
+	storage := metrics.NewMemStorage()
+	labeled := models.SeriesID("Alloc", models.Labels{"host": "a"})
+	require.NoError(t, storage.UpdateGauge(ctx, labeled, 1))
+
+	handleStatsDPacket(ctx, storage, "Alloc,host=a:5|g\nAlloc,host=a:+2|g\n")
+
+	m, err := storage.GetMetricsByTypeAndName(ctx, labeled, models.Gauge)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, *m.Value, "name with a comma must not overwrite the labeled series")
+	m, err = storage.GetMetricsByTypeAndName(ctx, models.SeriesID("Alloc,host=a", nil), models.Gauge)
+	require.NoError(t, err)
+	assert.Equal(t, 7.0, *m.Value)
+}
+
+func TestListenStatsD(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storage := metrics.NewMemStorage()
+
+	addr, err := ListenStatsD(ctx, "127.0.0.1:0", storage)
+	require.NoError(t, err)
+
+	conn, err := net.Dial("udp", addr.String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("PollCount:4|c\nAlloc:+1.5|g"))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		all, err := storage.GetAllMetrics(ctx)
+		return err == nil && all.Counters["PollCount"] == 4 && all.Gauges["Alloc"] == 1.5
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+)
+
+// streamKeepAlive — как часто слать комментарий в пустой поток,
+// чтобы прокси не закрывали соединение.
+const streamKeepAlive = 15 * time.Second
+
+// streamFilter выбирает изменения для подписчика: типы (пусто — gauge и counter),
+// шаблон имени path.Match (пусто — любое) и метки, которые должны совпасть все.
+type streamFilter struct {
+	Types  []string      `json:"types,omitempty"`
+	Name   string        `json:"name,omitempty"`
+	Labels models.Labels `json:"labels,omitempty"`
+}
+
+func (f streamFilter) Validate() error {
+	for _, t := range f.Types {
+		if t != models.Gauge && t != models.Counter {
+			return fmt.Errorf("only gauge and counter can be streamed, got '%s'", t)
+		}
+	}
+	if _, err := path.Match(f.Name, ""); err != nil {
+		return fmt.Errorf("bad name pattern '%s'", f.Name)
+	}
+	return f.Labels.Validate()
+}
+
+func (f streamFilter) Match(m models.Metrics) bool {
+	if len(f.Types) > 0 {
+		found := false
+		for _, t := range f.Types {
+			found = found || t == m.MType
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Name != "" {
+		if ok, _ := path.Match(f.Name, m.ID); !ok {
+			return false
+		}
+	}
+	for k, v := range f.Labels {
+		if m.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// streamHandler отдаёт изменения gauge и counter как Server-Sent Events:
+// GET /stream?type=gauge,counter&name=Heap*&host=a. Событие называется
+// по типу метрики, в data — JSON как у /value/. Если клиент не успевает
+// читать, перед следующим изменением придёт событие dropped с числом потерянных.
+func (h *Handler) streamHandler(w http.ResponseWriter, r *http.Request) {
+	streamer, ok := store.As[store.Streamer](h.storage)
+	if !ok {
+		http.Error(w, "Streaming is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	query := r.URL.Query()
+	labels, err := queryLabels(r, "type", "name")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := streamFilter{Name: query.Get("name"), Labels: labels}
+	for _, t := range strings.Split(query.Get("type"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			filter.Types = append(filter.Types, t)
+		}
+	}
+	if err := filter.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sub := streamer.Subscribe(filter.Match)
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	var reported uint64
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case m, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if dropped := sub.Dropped(); dropped > reported {
+				fmt.Fprintf(w, "event: dropped\ndata: {\"dropped\":%d}\n\n", dropped-reported)
+				reported = dropped
+			}
+			data, err := json.Marshal(m)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", m.MType, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
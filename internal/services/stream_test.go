@@ -0,0 +1,187 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ypMetrics/internal/metrics"
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+// readEvents читает n событий SSE, пропуская комментарии.
+func readEvents(t *testing.T, reader *bufio.Reader, n int) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var current sseEvent
+	for len(events) < n {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if current.name != "" {
+				events = append(events, current)
+			}
+			current = sseEvent{}
+		case strings.HasPrefix(line, "event: "):
+			current.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	return events
+}
+
+func newStreamServer(t *testing.T, storage store.Storage, middlewares ...mux.MiddlewareFunc) *httptest.Server {
+	t.Helper()
+	handler := NewHandler(storage)
+	router := mux.NewRouter()
+	router.Use(middlewares...)
+	router.HandleFunc("/stream", handler.streamHandler).Methods(http.MethodGet)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// openStream подключается к потоку и ждёт, пока подписка появится в хранилище.
+func openStream(t *testing.T, server *httptest.Server, storage store.Storage, query string, header http.Header) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/stream"+query, nil)
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// заголовки уходят после подписки, так что дальше события не потеряются
+	return bufio.NewReader(resp.Body)
+}
+
+func TestStreamHandler(t *testing.T) {
+	ctx := context.Background()
+	storage := store.NewStreamStorage(metrics.NewMemStorage())
+	server := newStreamServer(t, store.NewHistoryStorage(storage, time.Hour), gzipMiddleware)
+
+	all := openStream(t, server, storage, "", http.Header{"Accept-Encoding": {"gzip"}})
+	heap := openStream(t, server, storage, "?type=gauge&name=Heap*&host=a", nil)
+
+	require.NoError(t, storage.UpdateGauge(ctx, "HeapAlloc", 1))
+	require.NoError(t, storage.UpdateGauge(ctx, models.SeriesID("HeapAlloc", models.Labels{"host": "a"}), 2))
+	_, err := storage.UpdateCounter(ctx, "PollCount", 5)
+	require.NoError(t, err)
+	require.NoError(t, storage.UpdateGauge(ctx, models.SeriesID("HeapInuse", models.Labels{"host": "a"}), 3))
+
+	events := readEvents(t, all, 4)
+	assert.Equal(t, []string{"gauge", "gauge", "counter", "gauge"},
+		[]string{events[0].name, events[1].name, events[2].name, events[3].name})
+	assert.JSONEq(t, `{"id":"PollCount","type":"counter","delta":5}`, events[2].data)
+
+	events = readEvents(t, heap, 2)
+	var m models.Metrics
+	require.NoError(t, json.Unmarshal([]byte(events[0].data), &m))
+	assert.Equal(t, "HeapAlloc", m.ID)
+	assert.Equal(t, models.Labels{"host": "a"}, m.Labels)
+	assert.Equal(t, 2.0, *m.Value)
+	require.NoError(t, json.Unmarshal([]byte(events[1].data), &m))
+	assert.Equal(t, "HeapInuse", m.ID)
+}
+
+func TestStreamHandlerSigned(t *testing.T) {
+	ctx := context.Background()
+	storage := store.NewStreamStorage(metrics.NewMemStorage())
+	server := newStreamServer(t, storage, hashMiddleware("secret"))
+
+	// подписанный ответ копится до конца, поток же должен идти сразу
+	stream := openStream(t, server, storage, "", nil)
+	require.NoError(t, storage.UpdateGauge(ctx, "Alloc", 1))
+
+	events := readEvents(t, stream, 1)
+	assert.Equal(t, "gauge", events[0].name)
+}
+
+func TestStreamHandlerErrors(t *testing.T) {
+	storage := store.NewStreamStorage(metrics.NewMemStorage())
+	tests := []struct {
+		name       string
+		storage    store.Storage
+		query      string
+		statusCode int
+	}{
+		{name: "histograms are not streamed", storage: storage, query: "?type=histogram", statusCode: http.StatusBadRequest},
+		{name: "bad name pattern", storage: storage, query: "?name=Heap[", statusCode: http.StatusBadRequest},
+		{name: "repeated label", storage: storage, query: "?host=a&host=b", statusCode: http.StatusBadRequest},
+		{name: "no streaming storage", storage: metrics.NewMemStorage(), statusCode: http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler(tt.storage)
+			record := httptest.NewRecorder()
+			handler.streamHandler(record, httptest.NewRequest(http.MethodGet, "/stream"+tt.query, nil))
+			assert.Equal(t, tt.statusCode, record.Code)
+		})
+	}
+}
+
+func TestStreamHandlerStopsWithServer(t *testing.T) {
+	storage := store.NewStreamStorage(metrics.NewMemStorage())
+	done := make(chan struct{})
+	handler := &Handler{storage: storage, done: done}
+
+	finished := make(chan struct{})
+	go func() {
+		handler.streamHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stream", nil))
+		close(finished)
+	}()
+
+	close(done)
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("stream did not stop")
+	}
+}
+
+func TestStreamFilter(t *testing.T) {
+	gauge := models.Metrics{ID: "HeapAlloc", MType: models.Gauge, Labels: models.Labels{"host": "a"}}
+	tests := []struct {
+		name   string
+		filter streamFilter
+		want   bool
+	}{
+		{name: "empty", want: true},
+		{name: "type", filter: streamFilter{Types: []string{models.Counter, models.Gauge}}, want: true},
+		{name: "other type", filter: streamFilter{Types: []string{models.Counter}}, want: false},
+		{name: "name pattern", filter: streamFilter{Name: "Heap*"}, want: true},
+		{name: "other name", filter: streamFilter{Name: "Stack*"}, want: false},
+		{name: "labels", filter: streamFilter{Labels: models.Labels{"host": "a"}}, want: true},
+		{name: "other labels", filter: streamFilter{Labels: models.Labels{"host": "b"}}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Match(gauge))
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsWriteWait — сколько ждём отправки одного кадра, прежде чем считать клиента мёртвым
+	wsWriteWait = 10 * time.Second
+	// wsCloseWait — сколько даём на вежливое закрытие медленного клиента
+	wsCloseWait = time.Second
+	// wsPongWait — сколько ждём pong или любого сообщения от клиента
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	// wsMaxMessage ограничивает сообщения клиента: там только команды подписки
+	wsMaxMessage = 4096
+	// wsMaxSubscriptions — сколько подписок можно держать в одном соединении
+	wsMaxSubscriptions = 64
+	// wsRepliesBuffer — сколько ответов на команды копится для отправки
+	wsRepliesBuffer = 16
+)
+
+// wsUpgrader по умолчанию пускает только страницы с того же хоста.
+var wsUpgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+// wsRequest — команда клиента:
+// {"action":"subscribe","id":"heap","types":["gauge"],"name":"Heap*","labels":{"host":"a"}}
+// или {"action":"unsubscribe","id":"heap"}. Фильтр такой же, как у /stream.
+type wsRequest struct {
+	Action string `json:"action"`
+	ID     string `json:"id"`
+	streamFilter
+}
+
+// wsReply — ответ на команду. В отличие от кадров с метриками у него есть поле event:
+// subscribed, unsubscribed или error.
+type wsReply struct {
+	Event string `json:"event"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// wsClient хранит подписки одного соединения. match вызывается хранилищем
+// при каждой записи, поэтому подписки под мьютексом.
+type wsClient struct {
+	mu      sync.RWMutex
+	filters map[string]streamFilter
+}
+
+func (c *wsClient) match(m models.Metrics) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, f := range c.filters {
+		if f.Match(m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *wsClient) handle(req wsRequest) wsReply {
+	if req.ID == "" {
+		return wsReply{Event: "error", Error: "subscription id is required"}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch req.Action {
+	case "subscribe":
+		if err := req.Validate(); err != nil {
+			return wsReply{Event: "error", ID: req.ID, Error: err.Error()}
+		}
+		if _, ok := c.filters[req.ID]; !ok && len(c.filters) >= wsMaxSubscriptions {
+			return wsReply{Event: "error", ID: req.ID, Error: fmt.Sprintf("too many subscriptions, limit is %d", wsMaxSubscriptions)}
+		}
+		// повторная подписка с тем же id заменяет фильтр
+		c.filters[req.ID] = req.streamFilter
+		return wsReply{Event: "subscribed", ID: req.ID}
+	case "unsubscribe":
+		if _, ok := c.filters[req.ID]; !ok {
+			return wsReply{Event: "error", ID: req.ID, Error: "subscription not found"}
+		}
+		delete(c.filters, req.ID)
+		return wsReply{Event: "unsubscribed", ID: req.ID}
+	default:
+		return wsReply{Event: "error", ID: req.ID, Error: fmt.Sprintf("unknown action '%s'", req.Action)}
+	}
+}
+
+// readLoop разбирает команды, пока клиент на связи. Клиент, который шлёт
+// команды быстрее, чем читает ответы, отключается.
+func (c *wsClient) readLoop(conn *websocket.Conn, replies chan<- wsReply) {
+	conn.SetReadLimit(wsMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		var reply wsReply
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			reply = wsReply{Event: "error", Error: fmt.Sprintf("bad request: %v", err)}
+		} else {
+			reply = c.handle(req)
+		}
+		select {
+		case replies <- reply:
+		default:
+			return
+		}
+	}
+}
+
+// websocketHandler — двусторонняя версия /stream для GET /ws. Клиент
+// подписывается и отписывается командами wsRequest и получает кадры
+// models.Metrics, как у /value/, по одному на изменение, даже если оно подходит
+// под несколько подписок. Клиент, который не успевает читать, отключается
+// с кодом 1013 (try again later): запись метрик его не ждёт.
+func (h *Handler) websocketHandler(w http.ResponseWriter, r *http.Request) {
+	streamer, ok := store.As[store.Streamer](h.storage)
+	if !ok {
+		http.Error(w, "Streaming is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	// Upgrade сам отвечает клиенту ошибкой
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	client := &wsClient{filters: make(map[string]streamFilter)}
+	sub := streamer.Subscribe(client.match)
+	defer sub.Close()
+
+	replies := make(chan wsReply, wsRepliesBuffer)
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		client.readLoop(conn, replies)
+	}()
+
+	// пишущий цикл может застрять в записи, поэтому медленного клиента
+	// отключает отдельная горутина: Close и WriteControl можно звать параллельно
+	writeDone := make(chan struct{})
+	defer close(writeDone)
+	go func() {
+		select {
+		case <-sub.Overflow():
+			closeWebsocket(conn, websocket.CloseTryAgainLater, "client is too slow")
+		case <-writeDone:
+		}
+	}()
+
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	for {
+		var err error
+		select {
+		case <-readDone:
+			return
+		case <-h.done:
+			closeWebsocket(conn, websocket.CloseGoingAway, "server is shutting down")
+			return
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+		case reply := <-replies:
+			err = writeWebsocketJSON(conn, reply)
+		case m, ok := <-sub.C:
+			if !ok {
+				closeWebsocket(conn, websocket.CloseGoingAway, "server is shutting down")
+				return
+			}
+			err = writeWebsocketJSON(conn, m)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeWebsocketJSON(conn *websocket.Conn, v any) error {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return conn.WriteJSON(v)
+}
+
+// closeWebsocket пробует отправить кадр закрытия и рвёт соединение:
+// клиент, у которого забит буфер, кадр может и не получить.
+func closeWebsocket(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsCloseWait))
+	conn.Close()
+}
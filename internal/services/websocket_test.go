@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ypMetrics/internal/metrics"
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newWebsocketServer(t *testing.T, storage store.Storage, middlewares ...mux.MiddlewareFunc) *httptest.Server {
+	t.Helper()
+	handler := NewHandler(storage)
+	router := mux.NewRouter()
+	router.Use(middlewares...)
+	router.HandleFunc("/ws", handler.websocketHandler).Methods(http.MethodGet)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dialWebsocket(t *testing.T, server *httptest.Server, header http.Header) *websocket.Conn {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", header)
+	require.NoError(t, err)
+	resp.Body.Close()
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// command отправляет команду и возвращает ответ на неё.
+func command(t *testing.T, conn *websocket.Conn, req string) wsReply {
+	t.Helper()
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(req)))
+	var reply wsReply
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	require.NoError(t, conn.ReadJSON(&reply))
+	return reply
+}
+
+func readMetric(t *testing.T, conn *websocket.Conn) models.Metrics {
+	t.Helper()
+	var m models.Metrics
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	require.NoError(t, conn.ReadJSON(&m))
+	return m
+}
+
+func TestWebsocketHandler(t *testing.T) {
+	ctx := context.Background()
+	storage := store.NewStreamStorage(metrics.NewMemStorage())
+	server := newWebsocketServer(t, store.NewHistoryStorage(storage, time.Hour), gzipMiddleware, hashMiddleware("secret"))
+	conn := dialWebsocket(t, server, http.Header{"Accept-Encoding": {"gzip"}})
+
+	assert.Equal(t, wsReply{Event: "subscribed", ID: "heap"},
+		command(t, conn, `{"action":"subscribe","id":"heap","types":["gauge"],"name":"Heap*","labels":{"host":"a"}}`))
+	assert.Equal(t, wsReply{Event: "subscribed", ID: "polls"},
+		command(t, conn, `{"action":"subscribe","id":"polls","name":"Poll*"}`))
+	assert.Equal(t, wsReply{Event: "subscribed", ID: "all-heap"},
+		command(t, conn, `{"action":"subscribe","id":"all-heap","name":"HeapAlloc"}`))
+
+	require.NoError(t, storage.UpdateGauge(ctx, "Alloc", 1))
+	require.NoError(t, storage.UpdateGauge(ctx, models.SeriesID("HeapAlloc", models.Labels{"host": "a"}), 2))
+	_, err := storage.UpdateCounter(ctx, "PollCount", 5)
+	require.NoError(t, err)
+
+	// подходит под две подписки, но приходит один раз
+	m := readMetric(t, conn)
+	assert.Equal(t, "HeapAlloc", m.ID)
+	assert.Equal(t, models.Labels{"host": "a"}, m.Labels)
+	assert.Equal(t, 2.0, *m.Value)
+	m = readMetric(t, conn)
+	assert.Equal(t, "PollCount", m.ID)
+	assert.Equal(t, int64(5), *m.Delta)
+
+	assert.Equal(t, wsReply{Event: "unsubscribed", ID: "polls"},
+		command(t, conn, `{"action":"unsubscribe","id":"polls"}`))
+	_, err = storage.UpdateCounter(ctx, "PollCount", 1)
+	require.NoError(t, err)
+	require.NoError(t, storage.UpdateGauge(ctx, "HeapAlloc", 3))
+
+	m = readMetric(t, conn)
+	assert.Equal(t, "HeapAlloc", m.ID, "unsubscribed counter is not sent")
+	assert.Equal(t, 3.0, *m.Value)
+}
+
+func TestWebsocketHandlerCommands(t *testing.T) {
+	server := newWebsocketServer(t, store.NewStreamStorage(metrics.NewMemStorage()))
+	conn := dialWebsocket(t, server, nil)
+
+	tests := []struct {
+		name    string
+		request string
+		want    wsReply
+	}{
+		{name: "not json", request: `subscribe`, want: wsReply{Event: "error"}},
+		{name: "no id", request: `{"action":"subscribe"}`, want: wsReply{Event: "error", Error: "subscription id is required"}},
+		{name: "histograms are not streamed", request: `{"action":"subscribe","id":"h","types":["histogram"]}`, want: wsReply{Event: "error", ID: "h"}},
+		{name: "bad name pattern", request: `{"action":"subscribe","id":"h","name":"Heap["}`, want: wsReply{Event: "error", ID: "h"}},
+		{name: "unknown subscription", request: `{"action":"unsubscribe","id":"h"}`, want: wsReply{Event: "error", ID: "h", Error: "subscription not found"}},
+		{name: "unknown action", request: `{"action":"list","id":"h"}`, want: wsReply{Event: "error", ID: "h", Error: "unknown action 'list'"}},
+		{name: "resubscribe", request: `{"action":"subscribe","id":"h","name":"Heap*"}`, want: wsReply{Event: "subscribed", ID: "h"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := command(t, conn, tt.request)
+			if tt.want.Error == "" && reply.Error != "" {
+				tt.want.Error = reply.Error
+			}
+			assert.Equal(t, tt.want, reply)
+		})
+	}
+}
+
+func TestWebsocketHandlerDisabled(t *testing.T) {
+	handler := NewHandler(metrics.NewMemStorage())
+	record := httptest.NewRecorder()
+	handler.websocketHandler(record, httptest.NewRequest(http.MethodGet, "/ws", nil))
+	assert.Equal(t, http.StatusNotImplemented, record.Code)
+}
+
+// smallBufferListener урезает буферы сокетов сервера, чтобы медленный клиент
+// забивал их за сотни кадров, а не за мегабайты.
+type smallBufferListener struct {
+	net.Listener
+}
+
+func (l smallBufferListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetWriteBuffer(4096)
+	}
+	return conn, err
+}
+
+func TestWebsocketHandlerDropsSlowClient(t *testing.T) {
+	ctx := context.Background()
+	storage := store.NewStreamStorage(metrics.NewMemStorage())
+	handler := NewHandler(storage)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(handler.websocketHandler))
+	server.Listener = smallBufferListener{server.Listener}
+	server.Start()
+	t.Cleanup(server.Close)
+
+	dialer := websocket.Dialer{NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.SetReadBuffer(4096)
+		}
+		return conn, err
+	}}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	defer conn.Close()
+	require.Equal(t, "subscribed", command(t, conn, `{"action":"subscribe","id":"all"}`).Event)
+
+	// клиент не читает, а запись не должна его ждать
+	const updates = 20000
+	started := time.Now()
+	for i := range updates {
+		require.NoError(t, storage.UpdateGauge(ctx, "Alloc", float64(i)))
+	}
+	assert.Less(t, time.Since(started), 5*time.Second)
+
+	received := 0
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err = conn.ReadMessage(); err != nil {
+			break
+		}
+		received++
+	}
+	assert.Less(t, received, updates)
+	var netErr net.Error
+	assert.False(t, errors.As(err, &netErr) && netErr.Timeout(), "slow client is not disconnected")
+}
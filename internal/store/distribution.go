@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+
+	"ypMetrics/models"
+)
+
+// SummaryWindow — сколько последних наблюдений summary хранит для квантилей.
+// Count и Sum при этом считаются по всем наблюдениям.
+const SummaryWindow = 1024
+
+// HistogramState — гистограмма в хранилище. Counts не накопительные,
+// по одной ячейке на границу плюс последняя для значений больше всех границ.
+type HistogramState struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Count  uint64    `json:"count"`
+	Sum    float64   `json:"sum"`
+}
+
+// SummaryState — summary в хранилище: кольцо последних наблюдений.
+type SummaryState struct {
+	Quantiles []float64 `json:"quantiles"`
+	Window    []float64 `json:"window"`
+	Next      int       `json:"next"`
+	Count     uint64    `json:"count"`
+	Sum       float64   `json:"sum"`
+}
+
+// DistributionRestorer — хранилище, в которое можно вернуть гистограммы и summary
+// из снимка целиком: через UpdateBatch приходят только отдельные наблюдения.
+type DistributionRestorer interface {
+	RestoreDistributions(ctx context.Context, histograms map[string]HistogramState, summaries map[string]SummaryState) error
+}
+
+func NewHistogramState(bounds []float64) *HistogramState {
+	if len(bounds) == 0 {
+		bounds = models.DefaultBuckets
+	}
+	return &HistogramState{
+		Bounds: slices.Clone(bounds),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func NewSummaryState(quantiles []float64) *SummaryState {
+	if len(quantiles) == 0 {
+		quantiles = models.DefaultQuantiles
+	}
+	return &SummaryState{Quantiles: slices.Clone(quantiles)}
+}
+
+// CheckHistogram проверяет, что наблюдение m можно добавить в state:
+// явно заданные границы должны совпадать с границами серии.
+func CheckHistogram(state *HistogramState, m models.Metrics) error {
+	if state == nil || len(m.Buckets) == 0 || slices.Equal(state.Bounds, m.Buckets) {
+		return nil
+	}
+	return fmt.Errorf("histogram '%s': %w: buckets differ from the existing series", m.ID, models.ErrInvalidValue)
+}
+
+// CheckSummary — то же для квантилей summary.
+func CheckSummary(state *SummaryState, m models.Metrics) error {
+	if state == nil || len(m.Quantiles) == 0 || slices.Equal(state.Quantiles, m.Quantiles) {
+		return nil
+	}
+	return fmt.Errorf("summary '%s': %w: quantiles differ from the existing series", m.ID, models.ErrInvalidValue)
+}
+
+// ObserveHistogram добавляет наблюдение m в state, создавая его при state == nil.
+func ObserveHistogram(state *HistogramState, m models.Metrics) *HistogramState {
+	if state == nil {
+		state = NewHistogramState(m.Buckets)
+	}
+	state.Observe(*m.Value)
+	return state
+}
+
+// ObserveSummary добавляет наблюдение m в state, создавая его при state == nil.
+func ObserveSummary(state *SummaryState, m models.Metrics) *SummaryState {
+	if state == nil {
+		state = NewSummaryState(m.Quantiles)
+	}
+	state.Observe(*m.Value)
+	return state
+}
+
+func (h *HistogramState) Observe(v float64) {
+	// первая граница >= v: наблюдения на границе попадают в её корзину, как le в Prometheus
+	h.Counts[sort.SearchFloat64s(h.Bounds, v)]++
+	h.Count++
+	h.Sum += v
+}
+
+func (h HistogramState) Clone() HistogramState {
+	h.Bounds = slices.Clone(h.Bounds)
+	h.Counts = slices.Clone(h.Counts)
+	return h
+}
+
+// Data переводит состояние в накопительный вид для чтения.
+func (h HistogramState) Data() models.HistogramData {
+	data := models.HistogramData{
+		Buckets: make([]models.Bucket, len(h.Bounds)),
+		Count:   h.Count,
+		Sum:     h.Sum,
+	}
+	var cumulative uint64
+	for i, bound := range h.Bounds {
+		cumulative += h.Counts[i]
+		data.Buckets[i] = models.Bucket{UpperBound: bound, Count: cumulative}
+	}
+	return data
+}
+
+func (s *SummaryState) Observe(v float64) {
+	if len(s.Window) < SummaryWindow {
+		s.Window = append(s.Window, v)
+	} else {
+		s.Window[s.Next] = v
+	}
+	s.Next = (s.Next + 1) % SummaryWindow
+	s.Count++
+	s.Sum += v
+}
+
+func (s SummaryState) Clone() SummaryState {
+	s.Quantiles = slices.Clone(s.Quantiles)
+	s.Window = slices.Clone(s.Window)
+	return s
+}
+
+// Data считает квантили по окну методом ближайшего ранга.
+func (s SummaryState) Data() models.SummaryData {
+	data := models.SummaryData{
+		Quantiles: make([]models.Quantile, 0, len(s.Quantiles)),
+		Count:     s.Count,
+		Sum:       s.Sum,
+	}
+	if len(s.Window) == 0 {
+		return data
+	}
+
+	sorted := slices.Clone(s.Window)
+	slices.Sort(sorted)
+	for _, q := range s.Quantiles {
+		rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+		rank = max(0, min(rank, len(sorted)-1))
+		data.Quantiles = append(data.Quantiles, models.Quantile{Quantile: q, Value: sorted[rank]})
+	}
+	return data
+}
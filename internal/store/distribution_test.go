@@ -0,0 +1,77 @@
+package store_test
+
+import (
+	"testing"
+
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramState(t *testing.T) {
+	h := store.NewHistogramState([]float64{0.1, 0.5, 1})
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 3} {
+		h.Observe(v)
+	}
+
+	assert.Equal(t, models.HistogramData{
+		Buckets: []models.Bucket{
+			{UpperBound: 0.1, Count: 2},
+			{UpperBound: 0.5, Count: 3},
+			{UpperBound: 1, Count: 4},
+		},
+		Count: 5,
+		Sum:   4.15,
+	}, roundSum(h.Data()))
+
+	assert.Equal(t, models.DefaultBuckets, store.NewHistogramState(nil).Bounds)
+}
+
+func TestSummaryState(t *testing.T) {
+	s := store.NewSummaryState(nil)
+	for i := 1; i <= 100; i++ {
+		s.Observe(float64(i))
+	}
+
+	data := s.Data()
+	assert.Equal(t, uint64(100), data.Count)
+	assert.Equal(t, 5050.0, data.Sum)
+	assert.Equal(t, []models.Quantile{
+		{Quantile: 0.5, Value: 50},
+		{Quantile: 0.9, Value: 90},
+		{Quantile: 0.99, Value: 99},
+	}, data.Quantiles)
+}
+
+func TestSummaryStateWindow(t *testing.T) {
+	s := store.NewSummaryState([]float64{0, 1})
+	for i := 0; i < store.SummaryWindow; i++ {
+		s.Observe(1000)
+	}
+	// старые наблюдения вытесняются новыми, а Count и Sum помнят всё
+	for i := 0; i < store.SummaryWindow; i++ {
+		s.Observe(1)
+	}
+
+	data := s.Data()
+	assert.Len(t, s.Window, store.SummaryWindow)
+	assert.Equal(t, uint64(2*store.SummaryWindow), data.Count)
+	assert.Equal(t, []models.Quantile{{Quantile: 0, Value: 1}, {Quantile: 1, Value: 1}}, data.Quantiles)
+}
+
+func TestCheckHistogram(t *testing.T) {
+	value := 1.0
+	h := store.NewHistogramState([]float64{1, 2})
+
+	assert.NoError(t, store.CheckHistogram(nil, models.Metrics{ID: "x", Value: &value, Buckets: []float64{5}}))
+	assert.NoError(t, store.CheckHistogram(h, models.Metrics{ID: "x", Value: &value}))
+	assert.NoError(t, store.CheckHistogram(h, models.Metrics{ID: "x", Value: &value, Buckets: []float64{1, 2}}))
+	assert.ErrorIs(t, store.CheckHistogram(h, models.Metrics{ID: "x", Value: &value, Buckets: []float64{1, 3}}), models.ErrInvalidValue)
+}
+
+// roundSum убирает ошибку округления суммы дробных наблюдений.
+func roundSum(data models.HistogramData) models.HistogramData {
+	data.Sum = float64(int(data.Sum*1000+0.5)) / 1000
+	return data
+}
@@ -0,0 +1,17 @@
+package store
+
+import (
+	"time"
+
+	"ypMetrics/models"
+)
+
+// SetNow подменяет часы истории в тестах.
+func (s *HistoryStorage) SetNow(now func() time.Time) {
+	s.now = now
+}
+
+// LockOrder — порядок, в котором SQLStorage.UpdateBatch пишет пачку.
+func LockOrder(metrics []models.Metrics) []models.Metrics {
+	return lockOrder(metrics)
+}
@@ -1,2 +1,256 @@
 package store
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"ypMetrics/models"
+)
+
+// FileStorage оборачивает другое хранилище и сбрасывает его содержимое в файл:
+// раз в interval или после каждой записи, если interval равен нулю.
+type FileStorage struct {
+	Storage
+	path      string
+	syncWrite bool
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewFileStorage ожидает пустое inner: при restore счётчики из файла
+// прибавляются к уже имеющимся значениям.
+func NewFileStorage(inner Storage, path string, interval time.Duration, restore bool) (*FileStorage, error) {
+	s := &FileStorage{
+		Storage:   inner,
+		path:      path,
+		syncWrite: interval == 0,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	if restore {
+		if err := s.Load(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.syncWrite {
+		close(s.done)
+	} else {
+		go s.flushLoop(interval)
+	}
+	return s, nil
+}
+
+func (s *FileStorage) UpdateGauge(ctx context.Context, name string, value float64) error {
+	if err := s.Storage.UpdateGauge(ctx, name, value); err != nil {
+		return err
+	}
+	return s.saveIfSync(ctx)
+}
+
+func (s *FileStorage) UpdateCounter(ctx context.Context, name string, value int64) (int64, error) {
+	newValue, err := s.Storage.UpdateCounter(ctx, name, value)
+	if err != nil {
+		return 0, err
+	}
+	return newValue, s.saveIfSync(ctx)
+}
+
+func (s *FileStorage) UpdateBatch(ctx context.Context, metrics []models.Metrics) error {
+	if err := s.Storage.UpdateBatch(ctx, metrics); err != nil {
+		return err
+	}
+	return s.saveIfSync(ctx)
+}
+
+func (s *FileStorage) DeleteMetric(ctx context.Context, mName, mType string) error {
+	if err := s.Storage.DeleteMetric(ctx, mName, mType); err != nil {
+		return err
+	}
+	return s.saveIfSync(ctx)
+}
+
+func (s *FileStorage) ResetCounter(ctx context.Context, name string) error {
+	if err := s.Storage.ResetCounter(ctx, name); err != nil {
+		return err
+	}
+	return s.saveIfSync(ctx)
+}
+
+func (s *FileStorage) DeleteByPrefix(ctx context.Context, prefix string) (int, error) {
+	deleted, err := s.Storage.DeleteByPrefix(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+	return deleted, s.saveIfSync(ctx)
+}
+
+func (s *FileStorage) saveIfSync(ctx context.Context) error {
+	if !s.syncWrite {
+		return nil
+	}
+	return s.Save(ctx)
+}
+
+func (s *FileStorage) flushLoop(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Save(context.Background()); err != nil {
+				log.Printf("Error saving metrics to %s: %v", s.path, err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Save пишет снимок во временный файл и переименовывает его,
+// чтобы при падении не остаться с обрезанным файлом.
+func (s *FileStorage) Save(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot, err := s.Storage.GetAllMetrics(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read metrics: %w", err)
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metrics: %w", err)
+	}
+
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create storage dir: %w", err)
+		}
+	}
+
+	if err := replaceFile(s.path, data); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	return nil
+}
+
+// replaceFile пишет во временный файл и переименовывает его поверх path.
+func replaceFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *FileStorage) Load(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read metrics file: %w", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to parse metrics file: %w", err)
+	}
+
+	for name, value := range snapshot.Gauges {
+		if err := s.Storage.UpdateGauge(ctx, name, value); err != nil {
+			return fmt.Errorf("failed to restore gauge %s: %w", name, err)
+		}
+	}
+	for name, value := range snapshot.Counters {
+		if _, err := s.Storage.UpdateCounter(ctx, name, value); err != nil {
+			return fmt.Errorf("failed to restore counter %s: %w", name, err)
+		}
+	}
+
+	if len(snapshot.Histograms) == 0 && len(snapshot.Summaries) == 0 {
+		return nil
+	}
+	restorer, ok := s.Storage.(DistributionRestorer)
+	if !ok {
+		return errors.New("storage cannot restore histograms and summaries")
+	}
+	if err := restorer.RestoreDistributions(ctx, snapshot.Histograms, snapshot.Summaries); err != nil {
+		return fmt.Errorf("failed to restore histograms and summaries: %w", err)
+	}
+	return nil
+}
+
+// LoadState читает служебные данные из файла рядом с файлом метрик:
+// для metrics-db.json и ключа silences это metrics-db.silences.json.
+func (s *FileStorage) LoadState(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(s.statePath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("state '%s' %w", key, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func (s *FileStorage) SaveState(ctx context.Context, key string, data []byte) error {
+	if err := replaceFile(s.statePath(key), data); err != nil {
+		return fmt.Errorf("failed to write state %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *FileStorage) statePath(key string) string {
+	ext := filepath.Ext(s.path)
+	return strings.TrimSuffix(s.path, ext) + "." + key + ".json"
+}
+
+func (s *FileStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+// Ping проверяет вложенное хранилище и то, что каталог для файла доступен.
+func (s *FileStorage) Ping(ctx context.Context) error {
+	if err := s.Storage.Ping(ctx); err != nil {
+		return err
+	}
+	info, err := os.Stat(filepath.Dir(s.path))
+	if err != nil {
+		return fmt.Errorf("storage dir is unavailable: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("storage dir %s is not a directory", filepath.Dir(s.path))
+	}
+	return nil
+}
+
+// Close останавливает периодический сброс и записывает финальный снимок.
+func (s *FileStorage) Close() error {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+	return s.Save(context.Background())
+}
@@ -0,0 +1,172 @@
+package store_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ypMetrics/internal/metrics"
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorageSyncWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	ctx := context.Background()
+	s, err := store.NewFileStorage(metrics.NewMemStorage(), path, 0, false)
+	require.NoError(t, err)
+
+	require.NoError(t, s.UpdateGauge(ctx, "Alloc", 1.5))
+	_, err = s.UpdateCounter(ctx, "PollCount", 3)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"gauges":{"Alloc":1.5},"counters":{"PollCount":3}}`, string(data))
+	require.NoError(t, s.Close())
+}
+
+func TestFileStorageSyncDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	ctx := context.Background()
+	s, err := store.NewFileStorage(metrics.NewMemStorage(), path, 0, false)
+	require.NoError(t, err)
+
+	require.NoError(t, s.UpdateGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, s.UpdateGauge(ctx, "old.Alloc", 2))
+	_, err = s.UpdateCounter(ctx, "PollCount", 3)
+	require.NoError(t, err)
+
+	require.NoError(t, s.DeleteMetric(ctx, "Alloc", models.Gauge))
+	require.NoError(t, s.ResetCounter(ctx, "PollCount"))
+	_, err = s.DeleteByPrefix(ctx, "old.")
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"gauges":{},"counters":{"PollCount":0}}`, string(data))
+	require.NoError(t, s.Close())
+}
+
+func TestFileStorageRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	ctx := context.Background()
+	s, err := store.NewFileStorage(metrics.NewMemStorage(), path, time.Hour, false)
+	require.NoError(t, err)
+	require.NoError(t, s.UpdateGauge(ctx, "Alloc", 1.5))
+	_, err = s.UpdateCounter(ctx, "PollCount", 3)
+	require.NoError(t, err)
+
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "periodic mode must not write on every update")
+
+	require.NoError(t, s.Close())
+
+	restored, err := store.NewFileStorage(metrics.NewMemStorage(), path, time.Hour, true)
+	require.NoError(t, err)
+	defer restored.Close()
+
+	counter, err := restored.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+	metric, err := restored.GetMetricsByTypeAndName(ctx, "Alloc", "gauge")
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, *metric.Value)
+}
+
+func TestFileStorageRestoreDistributions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	ctx := context.Background()
+	s, err := store.NewFileStorage(metrics.NewMemStorage(), path, 0, false)
+	require.NoError(t, err)
+	for _, v := range []float64{0.2, 0.7} {
+		require.NoError(t, s.UpdateBatch(ctx, []models.Metrics{
+			{ID: "latency", MType: models.Histogram, Value: &v, Buckets: []float64{0.5, 1}},
+			{ID: "latency", MType: models.Summary, Value: &v},
+		}))
+	}
+	require.NoError(t, s.Close())
+
+	restored, err := store.NewFileStorage(metrics.NewMemStorage(), path, time.Hour, true)
+	require.NoError(t, err)
+	defer restored.Close()
+
+	histogram, err := restored.GetMetricsByTypeAndName(ctx, "latency", models.Histogram)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Bucket{{UpperBound: 0.5, Count: 1}, {UpperBound: 1, Count: 2}}, histogram.Histogram.Buckets)
+
+	summary, err := restored.GetMetricsByTypeAndName(ctx, "latency", models.Summary)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), summary.Summary.Count)
+	assert.Equal(t, 0.7, summary.Summary.Quantiles[len(summary.Summary.Quantiles)-1].Value)
+}
+
+func TestFileStorageRestoreMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "metrics.json")
+
+	s, err := store.NewFileStorage(metrics.NewMemStorage(), path, time.Hour, true)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	_, err = os.Stat(path)
+	assert.NoError(t, err, "final flush must create the file")
+}
+
+func TestFileStoragePing(t *testing.T) {
+	dir := t.TempDir()
+	s, err := store.NewFileStorage(metrics.NewMemStorage(), filepath.Join(dir, "metrics.json"), time.Hour, false)
+	require.NoError(t, err)
+	defer s.Close()
+
+	assert.NoError(t, s.Ping(context.Background()))
+
+	require.NoError(t, os.RemoveAll(dir))
+	assert.Error(t, s.Ping(context.Background()))
+}
+
+func TestFileStorageState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	ctx := context.Background()
+	s, err := store.NewFileStorage(metrics.NewMemStorage(), path, 0, false)
+	require.NoError(t, err)
+
+	_, err = s.LoadState(ctx, "silences")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	require.NoError(t, s.SaveState(ctx, "silences", []byte(`[{"id":"a"}]`)))
+	require.NoError(t, s.SaveState(ctx, "silences", []byte(`[{"id":"b"}]`)))
+	data, err := s.LoadState(ctx, "silences")
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"id":"b"}]`, string(data))
+	assert.FileExists(t, filepath.Join(filepath.Dir(path), "metrics.silences.json"))
+	require.NoError(t, s.Close())
+}
+
+func TestAs(t *testing.T) {
+	mem := metrics.NewMemStorage()
+	_, ok := store.As[store.StateStore](mem)
+	assert.False(t, ok, "memory storage keeps no state")
+
+	file, err := store.NewFileStorage(mem, filepath.Join(t.TempDir(), "metrics.json"), 0, false)
+	require.NoError(t, err)
+	history := store.NewHistoryStorage(file, time.Hour)
+
+	state, ok := store.As[store.StateStore](history)
+	require.True(t, ok, "found through the history wrapper")
+	assert.Same(t, file, state)
+
+	reader, ok := store.As[store.HistoryReader](history)
+	require.True(t, ok)
+	assert.Same(t, history, reader)
+	require.NoError(t, history.Close())
+}
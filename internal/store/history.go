@@ -0,0 +1,278 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"ypMetrics/models"
+)
+
+// HistoryCapacity — сколько последних точек хранится на серию,
+// даже если все они моложе срока хранения.
+const HistoryCapacity = 4096
+
+// Sample — значение метрики в момент записи. У счётчика это накопленная сумма.
+type Sample struct {
+	Time  time.Time `json:"t"`
+	Value float64   `json:"value"`
+}
+
+// HistoryReader отдаёт историю серии за [from, to].
+type HistoryReader interface {
+	History(ctx context.Context, mName, mType string, from, to time.Time) ([]Sample, error)
+}
+
+// HistoryStorage оборачивает другое хранилище и после каждой записи
+// gauge или counter кладёт новое значение в кольцевой буфер серии.
+// История живёт только в памяти и теряется при перезапуске.
+type HistoryStorage struct {
+	Storage
+	retention time.Duration
+	now       func() time.Time
+
+	mu      sync.RWMutex
+	series  map[string]*ring
+	sweptAt time.Time
+}
+
+func NewHistoryStorage(inner Storage, retention time.Duration) *HistoryStorage {
+	return &HistoryStorage{
+		Storage:   inner,
+		retention: retention,
+		now:       time.Now,
+		series:    make(map[string]*ring),
+	}
+}
+
+func (s *HistoryStorage) UpdateGauge(ctx context.Context, name string, value float64) error {
+	if err := s.Storage.UpdateGauge(ctx, name, value); err != nil {
+		return err
+	}
+	s.record(models.Gauge, name, value)
+	return nil
+}
+
+func (s *HistoryStorage) UpdateCounter(ctx context.Context, name string, value int64) (int64, error) {
+	newValue, err := s.Storage.UpdateCounter(ctx, name, value)
+	if err != nil {
+		return 0, err
+	}
+	s.record(models.Counter, name, float64(newValue))
+	return newValue, nil
+}
+
+// UpdateBatch перечитывает итоговые значения счётчиков после записи:
+// в пачке приходят только приращения. Пачка к этому моменту уже записана,
+// поэтому ошибка чтения только пропускает точку истории: иначе клиент
+// получил бы ошибку, повторил пачку и счётчики выросли бы дважды.
+func (s *HistoryStorage) UpdateBatch(ctx context.Context, metrics []models.Metrics) error {
+	if err := s.Storage.UpdateBatch(ctx, metrics); err != nil {
+		return err
+	}
+
+	seen := make(map[string]struct{})
+	for _, m := range metrics {
+		id := m.SeriesID()
+		switch m.MType {
+		case models.Gauge:
+			s.record(models.Gauge, id, *m.Value)
+		case models.Counter:
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			current, err := s.Storage.GetMetricsByTypeAndName(ctx, id, models.Counter)
+			if err != nil {
+				log.Printf("Error reading counter %s for history: %v", id, err)
+				continue
+			}
+			s.record(models.Counter, id, float64(*current.Delta))
+		}
+	}
+	return nil
+}
+
+func (s *HistoryStorage) ResetCounter(ctx context.Context, name string) error {
+	if err := s.Storage.ResetCounter(ctx, name); err != nil {
+		return err
+	}
+	s.record(models.Counter, name, 0)
+	return nil
+}
+
+func (s *HistoryStorage) DeleteMetric(ctx context.Context, mName, mType string) error {
+	if err := s.Storage.DeleteMetric(ctx, mName, mType); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.series, historyKey(mType, mName))
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *HistoryStorage) DeleteByPrefix(ctx context.Context, prefix string) (int, error) {
+	deleted, err := s.Storage.DeleteByPrefix(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	for key := range s.series {
+		_, name, _ := strings.Cut(key, ":")
+		if strings.HasPrefix(name, prefix) {
+			delete(s.series, key)
+		}
+	}
+	s.mu.Unlock()
+	return deleted, nil
+}
+
+// History возвращает точки серии за [from, to] по возрастанию времени.
+// Серии без истории — ErrNotFound, как и в GetMetricsByTypeAndName.
+func (s *HistoryStorage) History(ctx context.Context, mName, mType string, from, to time.Time) ([]Sample, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if mType != models.Gauge && mType != models.Counter {
+		return nil, fmt.Errorf("history of type '%s': %w", mType, models.ErrInvalidType)
+	}
+
+	s.mu.RLock()
+	r, ok := s.series[historyKey(mType, mName)]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("metric '%s' of type '%s' %w", mName, mType, ErrNotFound)
+	}
+
+	// всё старше срока хранения считается удалённым, даже если ещё лежит в буфере
+	if cutoff := s.now().Add(-s.retention); from.Before(cutoff) {
+		from = cutoff
+	}
+	return r.between(from, to), nil
+}
+
+func (s *HistoryStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+// Close закрывает вложенное хранилище, если ему есть что закрывать.
+func (s *HistoryStorage) Close() error {
+	if closer, ok := s.Storage.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// record пишет точку под блокировкой карты серий, чтобы sweep не выбросил
+// буфер между поиском и записью.
+func (s *HistoryStorage) record(mType, name string, value float64) {
+	key := historyKey(mType, name)
+	now := s.now()
+	sample, cutoff := Sample{Time: now, Value: value}, now.Add(-s.retention)
+
+	s.mu.RLock()
+	r, ok := s.series[key]
+	if ok {
+		r.push(sample, cutoff)
+	}
+	sweep := now.Sub(s.sweptAt) >= s.retention
+	s.mu.RUnlock()
+
+	if !ok || sweep {
+		s.mu.Lock()
+		if !ok {
+			if r, ok = s.series[key]; !ok {
+				r = &ring{}
+				s.series[key] = r
+			}
+			r.push(sample, cutoff)
+		}
+		if now.Sub(s.sweptAt) >= s.retention {
+			s.sweep(now, cutoff)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// sweep выбрасывает серии, все точки которых старше срока хранения: иначе
+// буферы давно умолкших серий копились бы с каждой новой меткой. Проход
+// по всем сериям делается не чаще раза за срок хранения. Вызывается под s.mu.
+func (s *HistoryStorage) sweep(now, cutoff time.Time) {
+	for key, r := range s.series {
+		if r.expired(cutoff) {
+			delete(s.series, key)
+		}
+	}
+	s.sweptAt = now
+}
+
+func historyKey(mType, name string) string {
+	return mType + ":" + name
+}
+
+// ring — кольцевой буфер точек одной серии, не больше HistoryCapacity.
+// Буфер растёт по мере надобности, head указывает на самую старую точку.
+type ring struct {
+	mu   sync.Mutex
+	buf  []Sample
+	head int
+	size int
+}
+
+func (r *ring) push(sample Sample, cutoff time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// выбрасываем с головы всё, что старше срока хранения
+	for r.size > 0 && r.at(0).Time.Before(cutoff) {
+		r.head = (r.head + 1) % len(r.buf)
+		r.size--
+	}
+
+	switch {
+	case r.size < len(r.buf):
+		r.buf[(r.head+r.size)%len(r.buf)] = sample
+		r.size++
+	case len(r.buf) < HistoryCapacity:
+		if r.head != 0 {
+			r.buf = append(r.buf[r.head:len(r.buf):len(r.buf)], r.buf[:r.head]...)
+			r.head = 0
+		}
+		r.buf = append(r.buf, sample)
+		r.size++
+	default:
+		// буфер полон — затираем самую старую точку
+		r.buf[r.head] = sample
+		r.head = (r.head + 1) % len(r.buf)
+	}
+}
+
+// expired — в буфере не осталось точек моложе cutoff.
+func (r *ring) expired(cutoff time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.size == 0 || r.at(r.size-1).Time.Before(cutoff)
+}
+
+func (r *ring) at(i int) Sample {
+	return r.buf[(r.head+i)%len(r.buf)]
+}
+
+func (r *ring) between(from, to time.Time) []Sample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]Sample, 0)
+	for i := 0; i < r.size; i++ {
+		sample := r.at(i)
+		if sample.Time.Before(from) || sample.Time.After(to) {
+			continue
+		}
+		result = append(result, sample)
+	}
+	return result
+}
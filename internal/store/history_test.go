@@ -0,0 +1,185 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ypMetrics/internal/metrics"
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHistory(t *testing.T, retention time.Duration) (*store.HistoryStorage, *time.Time) {
+	t.Helper()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := store.NewHistoryStorage(metrics.NewMemStorage(), retention)
+	s.SetNow(func() time.Time { return now })
+	return s, &now
+}
+
+func TestHistoryStorage(t *testing.T) {
+	ctx := context.Background()
+	s, now := newTestHistory(t, time.Hour)
+	start := *now
+
+	require.NoError(t, s.UpdateGauge(ctx, "HeapAlloc", 1))
+	*now = now.Add(time.Minute)
+	require.NoError(t, s.UpdateGauge(ctx, "HeapAlloc", 2))
+	_, err := s.UpdateCounter(ctx, "PollCount", 3)
+	require.NoError(t, err)
+	*now = now.Add(time.Minute)
+	delta := int64(4)
+	require.NoError(t, s.UpdateBatch(ctx, []models.Metrics{
+		{ID: "PollCount", MType: models.Counter, Delta: &delta},
+		{ID: "PollCount", MType: models.Counter, Delta: &delta},
+	}))
+
+	gauge, err := s.History(ctx, "HeapAlloc", models.Gauge, start, *now)
+	require.NoError(t, err)
+	assert.Equal(t, []store.Sample{
+		{Time: start, Value: 1},
+		{Time: start.Add(time.Minute), Value: 2},
+	}, gauge)
+
+	counter, err := s.History(ctx, "PollCount", models.Counter, start, *now)
+	require.NoError(t, err)
+	assert.Equal(t, []store.Sample{
+		{Time: start.Add(time.Minute), Value: 3},
+		{Time: start.Add(2 * time.Minute), Value: 11},
+	}, counter, "counter history keeps totals, one point per batch")
+
+	partial, err := s.History(ctx, "HeapAlloc", models.Gauge, start.Add(30*time.Second), *now)
+	require.NoError(t, err)
+	assert.Len(t, partial, 1)
+
+	_, err = s.History(ctx, "Missing", models.Gauge, start, *now)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	_, err = s.History(ctx, "HeapAlloc", models.Histogram, start, *now)
+	assert.ErrorIs(t, err, models.ErrInvalidType)
+
+	require.NoError(t, s.DeleteMetric(ctx, "HeapAlloc", models.Gauge))
+	_, err = s.History(ctx, "HeapAlloc", models.Gauge, start, *now)
+	assert.ErrorIs(t, err, store.ErrNotFound, "deleted metric loses its history")
+}
+
+// failingReads — хранилище, которое пишет, но не может прочитать метрику.
+type failingReads struct {
+	store.Storage
+}
+
+func (failingReads) GetMetricsByTypeAndName(context.Context, string, string) (models.Metrics, error) {
+	return models.Metrics{}, errors.New("read timeout")
+}
+
+func TestHistoryStorageBatchReadFailure(t *testing.T) {
+	ctx := context.Background()
+	inner := metrics.NewMemStorage()
+	s := store.NewHistoryStorage(failingReads{inner}, time.Hour)
+
+	delta, value := int64(4), 1.5
+	require.NoError(t, s.UpdateBatch(ctx, []models.Metrics{
+		{ID: "PollCount", MType: models.Counter, Delta: &delta},
+		{ID: "Alloc", MType: models.Gauge, Value: &value},
+	}), "written batch must not fail because of history")
+
+	all, err := inner.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), all.Counters["PollCount"])
+
+	_, err = s.History(ctx, "PollCount", models.Counter, time.Time{}, time.Now())
+	assert.ErrorIs(t, err, store.ErrNotFound, "counter point is skipped")
+	gauge, err := s.History(ctx, "Alloc", models.Gauge, time.Time{}, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, gauge, 1)
+}
+
+func TestHistoryStorageRetention(t *testing.T) {
+	ctx := context.Background()
+	s, now := newTestHistory(t, 10*time.Minute)
+	start := *now
+
+	for i := 0; i < 30; i++ {
+		require.NoError(t, s.UpdateGauge(ctx, "HeapAlloc", float64(i)))
+		*now = now.Add(time.Minute)
+	}
+
+	samples, err := s.History(ctx, "HeapAlloc", models.Gauge, start, *now)
+	require.NoError(t, err)
+	require.Len(t, samples, 10)
+	assert.Equal(t, 20.0, samples[0].Value)
+	assert.Equal(t, 29.0, samples[9].Value)
+}
+
+func TestHistoryStorageDropsSeries(t *testing.T) {
+	ctx := context.Background()
+	s, now := newTestHistory(t, 10*time.Minute)
+	labeled := models.SeriesID("Fresh", models.Labels{"host": "a"})
+
+	require.NoError(t, s.UpdateGauge(ctx, "Old", 1))
+	*now = now.Add(15 * time.Minute)
+	require.NoError(t, s.UpdateGauge(ctx, "Fresh", 2))
+	require.NoError(t, s.UpdateGauge(ctx, labeled, 3))
+
+	_, err := s.History(ctx, "Old", models.Gauge, now.Add(-time.Hour), *now)
+	assert.ErrorIs(t, err, store.ErrNotFound, "series with only expired samples is dropped")
+	_, err = s.History(ctx, labeled, models.Gauge, now.Add(-time.Hour), *now)
+	require.NoError(t, err)
+
+	_, err = s.DeleteByPrefix(ctx, "Fresh")
+	require.NoError(t, err)
+	for _, id := range []string{"Fresh", labeled} {
+		_, err = s.History(ctx, id, models.Gauge, now.Add(-time.Hour), *now)
+		assert.ErrorIs(t, err, store.ErrNotFound, id)
+	}
+}
+
+func TestHistoryStorageCapacity(t *testing.T) {
+	ctx := context.Background()
+	s, now := newTestHistory(t, 24*time.Hour)
+	start := *now
+
+	total := store.HistoryCapacity + 10
+	for i := 0; i < total; i++ {
+		require.NoError(t, s.UpdateGauge(ctx, "HeapAlloc", float64(i)))
+		*now = now.Add(time.Second)
+	}
+
+	samples, err := s.History(ctx, "HeapAlloc", models.Gauge, start, *now)
+	require.NoError(t, err)
+	require.Len(t, samples, store.HistoryCapacity)
+	assert.Equal(t, 10.0, samples[0].Value, "oldest points are overwritten first")
+	assert.Equal(t, float64(total-1), samples[len(samples)-1].Value)
+	for i := 1; i < len(samples); i++ {
+		assert.True(t, samples[i].Time.After(samples[i-1].Time))
+	}
+}
+
+func TestHistoryStorageGrowsAfterEviction(t *testing.T) {
+	ctx := context.Background()
+	s, now := newTestHistory(t, 10*time.Minute)
+	start := *now
+
+	// пять точек, пауза — две из них устаревают, затем пачка точек
+	// заполняет освободившееся место и заставляет буфер расти после оборота
+	for i := 0; i < 5; i++ {
+		require.NoError(t, s.UpdateGauge(ctx, "HeapAlloc", float64(i)))
+		*now = now.Add(time.Minute)
+	}
+	*now = start.Add(12 * time.Minute)
+	for i := 12; i < 16; i++ {
+		require.NoError(t, s.UpdateGauge(ctx, "HeapAlloc", float64(i)))
+	}
+
+	samples, err := s.History(ctx, "HeapAlloc", models.Gauge, start, *now)
+	require.NoError(t, err)
+	values := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		values = append(values, sample.Value)
+	}
+	assert.Equal(t, []float64{2, 3, 4, 12, 13, 14, 15}, values)
+}
@@ -1,2 +1,472 @@
 package store
 
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"ypMetrics/models"
+)
+
+const queryTimeout = 5 * time.Second
+
+// Запросы написаны так, чтобы одинаково работать в Postgres и SQLite.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS gauges (
+		name  TEXT PRIMARY KEY,
+		value DOUBLE PRECISION NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS counters (
+		name  TEXT PRIMARY KEY,
+		value BIGINT NOT NULL
+	)`,
+	// гистограммы и summary хранятся целиком, в JSON состояния
+	`CREATE TABLE IF NOT EXISTS histograms (
+		name  TEXT PRIMARY KEY,
+		state TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS summaries (
+		name  TEXT PRIMARY KEY,
+		state TEXT NOT NULL
+	)`,
+	// служебные данные сервера, см. StateStore
+	`CREATE TABLE IF NOT EXISTS server_state (
+		key  TEXT PRIMARY KEY,
+		data TEXT NOT NULL
+	)`,
+}
+
+// metricTables — таблица для каждого типа метрики.
+var metricTables = map[string]string{
+	models.Gauge:     "gauges",
+	models.Counter:   "counters",
+	models.Histogram: "histograms",
+	models.Summary:   "summaries",
+}
+
+const (
+	upsertGaugeQuery = `INSERT INTO gauges (name, value) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value`
+	incrementCounterQuery = `INSERT INTO counters (name, value) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET value = counters.value + EXCLUDED.value
+		RETURNING value`
+	resetCounterQuery = `UPDATE counters SET value = 0 WHERE name = $1`
+	upsertStateQuery  = `INSERT INTO server_state (key, data) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET data = EXCLUDED.data`
+)
+
+type SQLStorage struct {
+	db *sql.DB
+	// rowLock дописывается к чтению состояния перед его изменением;
+	// в SQLite не нужен и не поддерживается: писатель и так один
+	rowLock string
+}
+
+// DriverFromDSN выбирает драйвер database/sql по виду DSN:
+// postgres-адреса уходят в pgx, всё остальное считается файлом SQLite.
+func DriverFromDSN(dsn string) (driver, source string) {
+	switch {
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"), strings.Contains(dsn, "host="):
+		return "pgx", dsn
+	case strings.HasPrefix(dsn, "sqlite://"):
+		return "sqlite", strings.TrimPrefix(dsn, "sqlite://")
+	default:
+		return "sqlite", dsn
+	}
+}
+
+func NewSQLStorage(driver, dsn string) (*SQLStorage, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if driver == "sqlite" {
+		// у SQLite один писатель, а :memory: вообще живёт в одном соединении
+		db.SetMaxOpenConns(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	for _, query := range schema {
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create schema: %w", err)
+		}
+	}
+
+	s := &SQLStorage{db: db}
+	if driver != "sqlite" {
+		s.rowLock = " FOR UPDATE"
+	}
+	return s, nil
+}
+
+func (s *SQLStorage) UpdateGauge(ctx context.Context, name string, value float64) error {
+	if err := models.ValidateValue(value); err != nil {
+		return fmt.Errorf("gauge '%s': %w", name, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, upsertGaugeQuery, name, value); err != nil {
+		return fmt.Errorf("failed to update gauge %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *SQLStorage) UpdateCounter(ctx context.Context, name string, value int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var newValue int64
+	if err := s.db.QueryRowContext(ctx, incrementCounterQuery, name, value).Scan(&newValue); err != nil {
+		return 0, fmt.Errorf("failed to update counter %s: %w", name, err)
+	}
+	return newValue, nil
+}
+
+func (s *SQLStorage) UpdateBatch(ctx context.Context, metrics []models.Metrics) error {
+	for _, m := range metrics {
+		if err := m.Validate(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, m := range lockOrder(metrics) {
+		id := m.SeriesID()
+		switch m.MType {
+		case models.Gauge:
+			_, err = tx.ExecContext(ctx, upsertGaugeQuery, id, *m.Value)
+		case models.Counter:
+			_, err = tx.ExecContext(ctx, incrementCounterQuery, id, *m.Delta)
+		case models.Histogram:
+			err = updateState(ctx, tx, "histograms", id, s.rowLock, NewHistogramState(m.Buckets), func(state *HistogramState) error {
+				if err := CheckHistogram(state, m); err != nil {
+					return err
+				}
+				state.Observe(*m.Value)
+				return nil
+			})
+		case models.Summary:
+			err = updateState(ctx, tx, "summaries", id, s.rowLock, NewSummaryState(m.Quantiles), func(state *SummaryState) error {
+				if err := CheckSummary(state, m); err != nil {
+					return err
+				}
+				state.Observe(*m.Value)
+				return nil
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update %s '%s': %w", m.MType, id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// lockOrder сортирует копию пачки по типу и ключу серии: строки блокируются
+// в одном порядке, и параллельные пачки с общими сериями не ловят deadlock.
+// Сортировка устойчивая, поэтому из повторов одной серии побеждает последний.
+func lockOrder(metrics []models.Metrics) []models.Metrics {
+	sorted := slices.Clone(metrics)
+	slices.SortStableFunc(sorted, func(a, b models.Metrics) int {
+		return cmp.Or(cmp.Compare(a.MType, b.MType), cmp.Compare(a.SeriesID(), b.SeriesID()))
+	})
+	return sorted
+}
+
+// updateState читает состояние серии под блокировкой строки, меняет его в apply
+// и записывает обратно. Пустая строка fresh вставляется заранее, чтобы
+// параллельные транзакции ждали друг друга даже на новой серии.
+func updateState[T any](ctx context.Context, tx *sql.Tx, table, id, rowLock string, fresh *T, apply func(*T) error) error {
+	initial, err := json.Marshal(fresh)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO "+table+" (name, state) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING", id, string(initial)); err != nil {
+		return err
+	}
+
+	var raw string
+	if err := tx.QueryRowContext(ctx, "SELECT state FROM "+table+" WHERE name = $1"+rowLock, id).Scan(&raw); err != nil {
+		return err
+	}
+	state := new(T)
+	if err := json.Unmarshal([]byte(raw), state); err != nil {
+		return fmt.Errorf("corrupted state: %w", err)
+	}
+	if err := apply(state); err != nil {
+		return err
+	}
+
+	updated, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE "+table+" SET state = $2 WHERE name = $1", id, string(updated))
+	return err
+}
+
+func (s *SQLStorage) GetAllMetrics(ctx context.Context) (Snapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	snapshot := Snapshot{
+		Gauges:     make(map[string]float64),
+		Counters:   make(map[string]int64),
+		Histograms: make(map[string]HistogramState),
+		Summaries:  make(map[string]SummaryState),
+	}
+
+	if err := s.scanAll(ctx, "SELECT name, value FROM gauges", func(rows *sql.Rows) error {
+		var name string
+		var value float64
+		if err := rows.Scan(&name, &value); err != nil {
+			return err
+		}
+		snapshot.Gauges[name] = value
+		return nil
+	}); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read gauges: %w", err)
+	}
+
+	if err := s.scanAll(ctx, "SELECT name, value FROM counters", func(rows *sql.Rows) error {
+		var name string
+		var value int64
+		if err := rows.Scan(&name, &value); err != nil {
+			return err
+		}
+		snapshot.Counters[name] = value
+		return nil
+	}); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read counters: %w", err)
+	}
+
+	if err := s.scanAll(ctx, "SELECT name, state FROM histograms", func(rows *sql.Rows) error {
+		var name, raw string
+		var state HistogramState
+		if err := rows.Scan(&name, &raw); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(raw), &state); err != nil {
+			return fmt.Errorf("corrupted histogram %s: %w", name, err)
+		}
+		snapshot.Histograms[name] = state
+		return nil
+	}); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read histograms: %w", err)
+	}
+
+	if err := s.scanAll(ctx, "SELECT name, state FROM summaries", func(rows *sql.Rows) error {
+		var name, raw string
+		var state SummaryState
+		if err := rows.Scan(&name, &raw); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(raw), &state); err != nil {
+			return fmt.Errorf("corrupted summary %s: %w", name, err)
+		}
+		snapshot.Summaries[name] = state
+		return nil
+	}); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read summaries: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+func (s *SQLStorage) scanAll(ctx context.Context, query string, scan func(rows *sql.Rows) error) error {
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SQLStorage) GetMetricsByTypeAndName(ctx context.Context, mName, mType string) (models.Metrics, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	metric := models.Metrics{MType: mType}
+	metric.ID, metric.Labels = models.ParseSeriesID(mName)
+	var err error
+
+	switch mType {
+	case models.Gauge:
+		var value float64
+		err = s.db.QueryRowContext(ctx, "SELECT value FROM gauges WHERE name = $1", mName).Scan(&value)
+		metric.Value = &value
+	case models.Counter:
+		var delta int64
+		err = s.db.QueryRowContext(ctx, "SELECT value FROM counters WHERE name = $1", mName).Scan(&delta)
+		metric.Delta = &delta
+	case models.Histogram:
+		var state HistogramState
+		if err = s.readState(ctx, "histograms", mName, &state); err == nil {
+			data := state.Data()
+			metric.Histogram = &data
+		}
+	case models.Summary:
+		var state SummaryState
+		if err = s.readState(ctx, "summaries", mName, &state); err == nil {
+			data := state.Data()
+			metric.Summary = &data
+		}
+	default:
+		return models.Metrics{}, models.ErrInvalidType
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Metrics{}, fmt.Errorf("metric '%s' of type '%s' %w", mName, mType, ErrNotFound)
+	}
+	if err != nil {
+		return models.Metrics{}, fmt.Errorf("failed to read metric: %w", err)
+	}
+	return metric, nil
+}
+
+func (s *SQLStorage) readState(ctx context.Context, table, name string, state interface{}) error {
+	var raw string
+	if err := s.db.QueryRowContext(ctx, "SELECT state FROM "+table+" WHERE name = $1", name).Scan(&raw); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(raw), state); err != nil {
+		return fmt.Errorf("corrupted state: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStorage) DeleteMetric(ctx context.Context, mName, mType string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	table, ok := metricTables[mType]
+	if !ok {
+		return models.ErrInvalidType
+	}
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM "+table+" WHERE name = $1", mName)
+	if err != nil {
+		return fmt.Errorf("failed to delete metric: %w", err)
+	}
+	return notFoundIfNoRows(result, mName, mType)
+}
+
+func (s *SQLStorage) ResetCounter(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, resetCounterQuery, name)
+	if err != nil {
+		return fmt.Errorf("failed to reset counter %s: %w", name, err)
+	}
+	return notFoundIfNoRows(result, name, models.Counter)
+}
+
+func (s *SQLStorage) DeleteByPrefix(ctx context.Context, prefix string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// не LIKE: в SQLite он не различает регистр, а в префиксе бывают % и _
+	deleted := 0
+	for _, table := range []string{"gauges", "counters", "histograms", "summaries"} {
+		result, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE substr(name, 1, $2) = $1",
+			prefix, utf8.RuneCountInString(prefix))
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to count deleted rows: %w", err)
+		}
+		deleted += int(n)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *SQLStorage) LoadState(ctx context.Context, key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var data string
+	err := s.db.QueryRowContext(ctx, "SELECT data FROM server_state WHERE key = $1", key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("state '%s' %w", key, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state %s: %w", key, err)
+	}
+	return []byte(data), nil
+}
+
+func (s *SQLStorage) SaveState(ctx context.Context, key string, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, upsertStateQuery, key, string(data)); err != nil {
+		return fmt.Errorf("failed to save state %s: %w", key, err)
+	}
+	return nil
+}
+
+func notFoundIfNoRows(result sql.Result, mName, mType string) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to count affected rows: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("metric '%s' of type '%s' %w", mName, mType, ErrNotFound)
+	}
+	return nil
+}
+
+func (s *SQLStorage) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	return s.db.PingContext(ctx)
+}
+
+func (s *SQLStorage) Close() error {
+	return s.db.Close()
+}
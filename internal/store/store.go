@@ -1,10 +1,72 @@
 package store
 
+import (
+	"context"
+	"errors"
+
+	"ypMetrics/models"
+)
+
+// ErrNotFound оборачивается хранилищами, когда метрики нет:
+// "metric 'x' of type 'gauge' not found".
+var ErrNotFound = errors.New("not found")
+
+// Snapshot — копия всех метрик хранилища на момент вызова.
+type Snapshot struct {
+	Gauges     map[string]float64        `json:"gauges"`
+	Counters   map[string]int64          `json:"counters"`
+	Histograms map[string]HistogramState `json:"histograms,omitempty"`
+	Summaries  map[string]SummaryState   `json:"summaries,omitempty"`
+}
+
+// Имя метрики в методах Storage — ключ серии (models.SeriesID):
+// имя вместе с метками, у метрик без меток это просто имя.
 type Storage interface {
-    // GetMetric(name string) (float64, error)
-    // SetMetric(name string, value float64) error
-	UpdateGauge(name string, value float64) 
-	UpdateCounter(name string, value int64) int64 
-	GetAllMetrics() map[string] interface{}
-	GetMetricsByTypeAndName(mName, mType string) ([]byte, error) 
-}
\ No newline at end of file
+	UpdateGauge(ctx context.Context, name string, value float64) error
+	UpdateCounter(ctx context.Context, name string, value int64) (int64, error)
+	GetAllMetrics(ctx context.Context) (Snapshot, error)
+	// GetMetricsByTypeAndName возвращает метрику с заполненным Delta или Value,
+	// ID и Labels разобраны из ключа серии.
+	GetMetricsByTypeAndName(ctx context.Context, mName, mType string) (models.Metrics, error)
+	// UpdateBatch применяет все метрики разом: либо все, либо ни одной.
+	UpdateBatch(ctx context.Context, metrics []models.Metrics) error
+	// DeleteMetric удаляет метрику; если её нет — ErrNotFound.
+	DeleteMetric(ctx context.Context, mName, mType string) error
+	// ResetCounter обнуляет существующий счётчик.
+	ResetCounter(ctx context.Context, name string) error
+	// DeleteByPrefix удаляет метрики всех типов с именем на prefix
+	// и возвращает, сколько удалено.
+	DeleteByPrefix(ctx context.Context, prefix string) (int, error)
+	// Ping проверяет, что хранилище доступно.
+	Ping(ctx context.Context) error
+}
+
+// StateStore — хранилище, рядом с метриками которого сервер держит свои
+// служебные данные, например тишины алертов: непрозрачный JSON по ключу.
+type StateStore interface {
+	// LoadState возвращает данные по ключу; если их нет — ErrNotFound.
+	LoadState(ctx context.Context, key string) ([]byte, error)
+	SaveState(ctx context.Context, key string, data []byte) error
+}
+
+// Unwrapper — обёртка над хранилищем, которая умеет отдать вложенное.
+type Unwrapper interface {
+	Unwrap() Storage
+}
+
+// As ищет среди s и вложенных в него хранилищ первое, реализующее T:
+// обёртки вроде HistoryStorage не прячут необязательные интерфейсы внутренних.
+func As[T any](s Storage) (T, bool) {
+	for s != nil {
+		if v, ok := s.(T); ok {
+			return v, true
+		}
+		u, ok := s.(Unwrapper)
+		if !ok {
+			break
+		}
+		s = u.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
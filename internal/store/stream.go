@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"ypMetrics/models"
+)
+
+// StreamBuffer — сколько изменений копится у подписчика. Если он не успевает
+// их забирать, новые изменения для него отбрасываются, а не тормозят запись.
+const StreamBuffer = 256
+
+// Streamer рассылает изменения gauge и counter подписчикам.
+type Streamer interface {
+	// Subscribe подписывает на изменения, для которых match возвращает true;
+	// nil match — на все.
+	Subscribe(match func(models.Metrics) bool) *Subscription
+}
+
+// Subscription — подписка на изменения. Канал C закрывается после Close
+// или при закрытии хранилища.
+type Subscription struct {
+	C <-chan models.Metrics
+
+	ch           chan models.Metrics
+	match        func(models.Metrics) bool
+	dropped      atomic.Uint64
+	overflow     chan struct{}
+	overflowOnce sync.Once
+	storage      *StreamStorage
+}
+
+// Dropped возвращает, сколько изменений отброшено с начала подписки.
+func (sub *Subscription) Dropped() uint64 {
+	return sub.dropped.Load()
+}
+
+// Overflow закрывается при первом отброшенном изменении — подписчик не успевает.
+func (sub *Subscription) Overflow() <-chan struct{} {
+	return sub.overflow
+}
+
+func (sub *Subscription) Close() {
+	sub.storage.unsubscribe(sub)
+}
+
+// StreamStorage оборачивает другое хранилище и после каждой записи gauge
+// или counter рассылает новое значение подписчикам. У счётчика это
+// накопленная сумма, как в GetMetricsByTypeAndName.
+type StreamStorage struct {
+	Storage
+
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func NewStreamStorage(inner Storage) *StreamStorage {
+	return &StreamStorage{
+		Storage: inner,
+		subs:    make(map[*Subscription]struct{}),
+	}
+}
+
+func (s *StreamStorage) Subscribe(match func(models.Metrics) bool) *Subscription {
+	ch := make(chan models.Metrics, StreamBuffer)
+	sub := &Subscription{C: ch, ch: ch, match: match, overflow: make(chan struct{}), storage: s}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		close(ch)
+		return sub
+	}
+	s.subs[sub] = struct{}{}
+	return sub
+}
+
+func (s *StreamStorage) unsubscribe(sub *Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subs[sub]; ok {
+		delete(s.subs, sub)
+		close(sub.ch)
+	}
+}
+
+func (s *StreamStorage) UpdateGauge(ctx context.Context, name string, value float64) error {
+	if err := s.Storage.UpdateGauge(ctx, name, value); err != nil {
+		return err
+	}
+	s.publish(models.Gauge, name, &value, nil)
+	return nil
+}
+
+func (s *StreamStorage) UpdateCounter(ctx context.Context, name string, value int64) (int64, error) {
+	newValue, err := s.Storage.UpdateCounter(ctx, name, value)
+	if err != nil {
+		return 0, err
+	}
+	s.publish(models.Counter, name, nil, &newValue)
+	return newValue, nil
+}
+
+// UpdateBatch, как и HistoryStorage, перечитывает итоговые значения счётчиков,
+// но только если кто-то подписан. Ошибка чтения после записанной пачки
+// только теряет событие.
+func (s *StreamStorage) UpdateBatch(ctx context.Context, metrics []models.Metrics) error {
+	if err := s.Storage.UpdateBatch(ctx, metrics); err != nil {
+		return err
+	}
+	if !s.hasSubscribers() {
+		return nil
+	}
+
+	seen := make(map[string]struct{})
+	for _, m := range metrics {
+		id := m.SeriesID()
+		switch m.MType {
+		case models.Gauge:
+			s.publish(models.Gauge, id, m.Value, nil)
+		case models.Counter:
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			current, err := s.Storage.GetMetricsByTypeAndName(ctx, id, models.Counter)
+			if err != nil {
+				log.Printf("Error reading counter %s for stream: %v", id, err)
+				continue
+			}
+			s.publish(models.Counter, id, nil, current.Delta)
+		}
+	}
+	return nil
+}
+
+func (s *StreamStorage) ResetCounter(ctx context.Context, name string) error {
+	if err := s.Storage.ResetCounter(ctx, name); err != nil {
+		return err
+	}
+	var zero int64
+	s.publish(models.Counter, name, nil, &zero)
+	return nil
+}
+
+func (s *StreamStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+// Close завершает все подписки и закрывает вложенное хранилище.
+func (s *StreamStorage) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for sub := range s.subs {
+		delete(s.subs, sub)
+		close(sub.ch)
+	}
+	s.mu.Unlock()
+
+	if closer, ok := s.Storage.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (s *StreamStorage) hasSubscribers() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.subs) > 0
+}
+
+func (s *StreamStorage) publish(mType, id string, value *float64, delta *int64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.subs) == 0 {
+		return
+	}
+
+	// копии: значения из пачки принадлежат вызывающему
+	name, labels := models.ParseSeriesID(id)
+	m := models.Metrics{ID: name, MType: mType, Labels: labels}
+	if value != nil {
+		v := *value
+		m.Value = &v
+	}
+	if delta != nil {
+		d := *delta
+		m.Delta = &d
+	}
+	for sub := range s.subs {
+		if sub.match != nil && !sub.match(m) {
+			continue
+		}
+		select {
+		case sub.ch <- m:
+		default:
+			sub.dropped.Add(1)
+			sub.overflowOnce.Do(func() { close(sub.overflow) })
+		}
+	}
+}
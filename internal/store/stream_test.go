@@ -0,0 +1,134 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"ypMetrics/internal/metrics"
+	"ypMetrics/internal/store"
+	"ypMetrics/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receive(t *testing.T, sub *store.Subscription, n int) []models.Metrics {
+	t.Helper()
+	var got []models.Metrics
+	for i := 0; i < n; i++ {
+		select {
+		case m := <-sub.C:
+			got = append(got, m)
+		default:
+			t.Fatalf("expected %d events, got %d", n, len(got))
+		}
+	}
+	select {
+	case m := <-sub.C:
+		t.Fatalf("unexpected event %+v", m)
+	default:
+	}
+	return got
+}
+
+func TestStreamStorage(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewStreamStorage(metrics.NewMemStorage())
+	all := s.Subscribe(nil)
+	defer all.Close()
+	gauges := s.Subscribe(func(m models.Metrics) bool { return m.MType == models.Gauge })
+	defer gauges.Close()
+
+	require.NoError(t, s.UpdateGauge(ctx, models.SeriesID("Alloc", models.Labels{"host": "a"}), 1.5))
+	_, err := s.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+	value := 3.0
+	require.NoError(t, s.UpdateBatch(ctx, []models.Metrics{
+		{ID: "PollCount", MType: models.Counter, Delta: ptr(int64(3))},
+		{ID: "PollCount", MType: models.Counter, Delta: ptr(int64(4))},
+		{ID: "Free", MType: models.Gauge, Value: &value},
+	}))
+	value = 100 // изменение пачки после записи не видно подписчикам
+	require.NoError(t, s.ResetCounter(ctx, "PollCount"))
+
+	got := receive(t, all, 5)
+	assert.Equal(t, models.Metrics{ID: "Alloc", MType: models.Gauge, Value: ptr(1.5), Labels: models.Labels{"host": "a"}}, got[0])
+	assert.Equal(t, models.Metrics{ID: "PollCount", MType: models.Counter, Delta: ptr(int64(2))}, got[1])
+	assert.Equal(t, models.Metrics{ID: "PollCount", MType: models.Counter, Delta: ptr(int64(9))}, got[2], "batch sends the total once")
+	assert.Equal(t, models.Metrics{ID: "Free", MType: models.Gauge, Value: ptr(3.0)}, got[3])
+	assert.Equal(t, models.Metrics{ID: "PollCount", MType: models.Counter, Delta: ptr(int64(0))}, got[4])
+
+	got = receive(t, gauges, 2)
+	assert.Equal(t, "Alloc", got[0].ID)
+	assert.Equal(t, "Free", got[1].ID)
+}
+
+func TestStreamStorageBatchReadFailure(t *testing.T) {
+	ctx := context.Background()
+	inner := metrics.NewMemStorage()
+	s := store.NewStreamStorage(failingReads{inner})
+	sub := s.Subscribe(nil)
+	defer sub.Close()
+
+	require.NoError(t, s.UpdateBatch(ctx, []models.Metrics{
+		{ID: "PollCount", MType: models.Counter, Delta: ptr(int64(4))},
+		{ID: "Alloc", MType: models.Gauge, Value: ptr(1.5)},
+	}), "written batch must not fail because of a subscriber")
+
+	all, err := inner.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), all.Counters["PollCount"])
+	got := receive(t, sub, 1)
+	assert.Equal(t, "Alloc", got[0].ID, "counter event is dropped")
+}
+
+func TestStreamStorageSlowSubscriber(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewStreamStorage(metrics.NewMemStorage())
+	sub := s.Subscribe(nil)
+	defer sub.Close()
+
+	require.NoError(t, s.UpdateGauge(ctx, "Alloc", 0))
+	select {
+	case <-sub.Overflow():
+		t.Fatal("overflow before the buffer is full")
+	default:
+	}
+	<-sub.C
+
+	for i := 0; i < store.StreamBuffer+10; i++ {
+		require.NoError(t, s.UpdateGauge(ctx, "Alloc", float64(i)))
+	}
+
+	assert.Len(t, sub.C, store.StreamBuffer)
+	assert.Equal(t, uint64(10), sub.Dropped(), "writes never block on a slow subscriber")
+	select {
+	case <-sub.Overflow():
+	default:
+		t.Fatal("overflow is not signalled")
+	}
+}
+
+func TestStreamStorageClose(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewStreamStorage(metrics.NewMemStorage())
+
+	closed := s.Subscribe(nil)
+	closed.Close()
+	closed.Close()
+	_, ok := <-closed.C
+	assert.False(t, ok)
+	require.NoError(t, s.UpdateGauge(ctx, "Alloc", 1), "no panic on a closed subscription")
+
+	open := s.Subscribe(nil)
+	require.NoError(t, s.Close())
+	_, ok = <-open.C
+	assert.False(t, ok, "storage close ends subscriptions")
+
+	_, ok = <-s.Subscribe(nil).C
+	assert.False(t, ok, "subscribing to a closed storage")
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// DefaultBuckets — границы гистограммы по умолчанию, как в клиенте Prometheus:
+// подходят для задержек в секундах.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefaultQuantiles — квантили summary по умолчанию.
+var DefaultQuantiles = []float64{0.5, 0.9, 0.99}
+
+// HistogramData — гистограмма при чтении. Счётчики корзин накопительные:
+// в корзину с границей UpperBound попадают все наблюдения <= UpperBound.
+// Последняя корзина +Inf не выводится, её значение — Count.
+type HistogramData struct {
+	Buckets []Bucket `json:"buckets"`
+	Count   uint64   `json:"count"`
+	Sum     float64  `json:"sum"`
+}
+
+type Bucket struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+// SummaryData — summary при чтении.
+type SummaryData struct {
+	Quantiles []Quantile `json:"quantiles"`
+	Count     uint64     `json:"count"`
+	Sum       float64    `json:"sum"`
+}
+
+type Quantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// ValidateBuckets требует конечные строго возрастающие границы.
+// Пустой список допустим и означает DefaultBuckets.
+func ValidateBuckets(buckets []float64) error {
+	for i, b := range buckets {
+		if math.IsNaN(b) || math.IsInf(b, 0) {
+			return fmt.Errorf("%w: bucket bound must be finite", ErrInvalidValue)
+		}
+		if i > 0 && b <= buckets[i-1] {
+			return fmt.Errorf("%w: bucket bounds must increase", ErrInvalidValue)
+		}
+	}
+	return nil
+}
+
+// ValidateQuantiles требует квантили из [0, 1].
+// Пустой список допустим и означает DefaultQuantiles.
+func ValidateQuantiles(quantiles []float64) error {
+	for _, q := range quantiles {
+		if math.IsNaN(q) || q < 0 || q > 1 {
+			return fmt.Errorf("%w: quantile must be in [0, 1]", ErrInvalidValue)
+		}
+	}
+	return nil
+}
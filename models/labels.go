@@ -0,0 +1,113 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Labels — метки серии, например {host="a", region="eu"}.
+// Одно имя метрики с разными метками хранится как разные серии.
+type Labels map[string]string
+
+var ErrInvalidLabel = errors.New("invalid label")
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `=`, `\=`)
+
+// nameEscaper экранирует в имени то, что иначе приняли бы за начало меток:
+// "a,b=c" без меток не должно совпасть с "a" с меткой b=c.
+var nameEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`)
+
+// Validate требует непустые ключи и значения: пустая метка
+// неотличима от отсутствующей.
+func (l Labels) Validate() error {
+	for k, v := range l {
+		if k == "" {
+			return fmt.Errorf("%w: empty name", ErrInvalidLabel)
+		}
+		if v == "" {
+			return fmt.Errorf("%w: empty value for '%s'", ErrInvalidLabel, k)
+		}
+	}
+	return nil
+}
+
+// SeriesID — ключ серии в хранилище: имя и отсортированные метки,
+// "Alloc,host=a,region=eu". Без меток ключ совпадает с именем (если в нём
+// нет запятых и обратных слешей), поэтому метрики без меток хранятся как раньше.
+func SeriesID(name string, labels Labels) string {
+	name = nameEscaper.Replace(name)
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(labelEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(labelEscaper.Replace(labels[k]))
+	}
+	return b.String()
+}
+
+// ParseSeriesID разбирает ключ, собранный SeriesID. Если хвост после
+// первой неэкранированной запятой не похож на метки, весь id считается
+// именем: так читаются ключи, сохранённые до экранирования имён.
+func ParseSeriesID(id string) (string, Labels) {
+	parts := splitEscaped(id, ',')
+	if len(parts) == 1 {
+		return unescapeLabel(id), nil
+	}
+
+	labels := make(Labels)
+	for _, pair := range parts[1:] {
+		kv := splitEscaped(pair, '=')
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return id, nil
+		}
+		labels[unescapeLabel(kv[0])] = unescapeLabel(kv[1])
+	}
+	return unescapeLabel(parts[0]), labels
+}
+
+// SeriesID возвращает ключ серии метрики с учётом её меток.
+func (m Metrics) SeriesID() string {
+	return SeriesID(m.ID, m.Labels)
+}
+
+func splitEscaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unescapeLabel(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
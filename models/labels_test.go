@@ -0,0 +1,90 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeriesID(t *testing.T) {
+	tests := []struct {
+		name       string
+		metric     string
+		labels     Labels
+		want       string
+		wantName   string
+		wantLabels Labels
+	}{
+		{
+			name:     "no labels",
+			metric:   "Alloc",
+			want:     "Alloc",
+			wantName: "Alloc",
+		},
+		{
+			name:       "labels are sorted",
+			metric:     "Alloc",
+			labels:     Labels{"region": "eu", "host": "a"},
+			want:       "Alloc,host=a,region=eu",
+			wantName:   "Alloc",
+			wantLabels: Labels{"host": "a", "region": "eu"},
+		},
+		{
+			name:       "separators are escaped",
+			metric:     "disk",
+			labels:     Labels{"path": `/var,log`, "k=v": `C:\`},
+			want:       `disk,k\=v=C:\\,path=/var\,log`,
+			wantName:   "disk",
+			wantLabels: Labels{"path": "/var,log", "k=v": `C:\`},
+		},
+		{
+			name:     "name with separators",
+			metric:   `a,b=c\`,
+			want:     `a\,b=c\\`,
+			wantName: `a,b=c\`,
+		},
+		{
+			name:       "labeled name with separators",
+			metric:     "a,b",
+			labels:     Labels{"c": "d"},
+			want:       `a\,b,c=d`,
+			wantName:   "a,b",
+			wantLabels: Labels{"c": "d"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := SeriesID(tt.metric, tt.labels)
+			assert.Equal(t, tt.want, id)
+
+			name, labels := ParseSeriesID(id)
+			assert.Equal(t, tt.wantName, name)
+			assert.Equal(t, tt.wantLabels, labels)
+		})
+	}
+}
+
+func TestParseSeriesIDWithoutLabels(t *testing.T) {
+	// ключ, сохранённый до экранирования имён: запятая не превращается в метки
+	name, labels := ParseSeriesID("a,b")
+	assert.Equal(t, "a,b", name)
+	assert.Nil(t, labels)
+}
+
+func TestSeriesIDCollision(t *testing.T) {
+	// имя не должно подделывать метки чужой серии
+	assert.NotEqual(t, SeriesID("a", Labels{"b": "c"}), SeriesID("a,b=c", nil))
+	assert.NotEqual(t, SeriesID("a", Labels{"b": "c", "d": "e"}), SeriesID("a,b=c", Labels{"d": "e"}))
+	assert.NotEqual(t, SeriesID(`a\`, Labels{"b": "c"}), SeriesID(`a\,b=c`, nil))
+}
+
+func TestLabelsValidate(t *testing.T) {
+	assert.NoError(t, Labels(nil).Validate())
+	assert.NoError(t, Labels{"host": "a"}.Validate())
+	assert.ErrorIs(t, Labels{"": "a"}.Validate(), ErrInvalidLabel)
+	assert.ErrorIs(t, Labels{"host": ""}.Validate(), ErrInvalidLabel)
+
+	value := 1.0
+	err := Metrics{ID: "Alloc", MType: Gauge, Value: &value, Labels: Labels{"host": ""}}.Validate()
+	assert.ErrorIs(t, err, ErrInvalidLabel)
+}
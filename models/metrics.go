@@ -1,8 +1,16 @@
 package models
 
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
 const (
-	Counter = "counter"
-	Gauge   = "gauge"
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
+	Summary   = "summary"
 )
 
 // NOTE: Не усложняем пример, вводя иерархическую вложенность структур.
@@ -10,12 +18,76 @@ const (
 // Delta и Value объявлены через указатели,
 // что бы отличать значение "0", от не заданного значения
 // и соответственно не кодировать в структуру.
+// У histogram и summary Value при обновлении — одно наблюдение,
+// Buckets и Quantiles задают границы и квантили новой серии,
+// а при чтении заполняются Histogram или Summary.
 type Metrics struct {
-	ID    string   `json:"id"`
-	MType string   `json:"type"`
-	Delta *int64   `json:"delta,omitempty"`
-	Value *float64 `json:"value,omitempty"`
-	Hash  string   `json:"hash,omitempty"`
+	ID        string         `json:"id"`
+	MType     string         `json:"type"`
+	Delta     *int64         `json:"delta,omitempty"`
+	Value     *float64       `json:"value,omitempty"`
+	Hash      string         `json:"hash,omitempty"`
+	Labels    Labels         `json:"labels,omitempty"`
+	Buckets   []float64      `json:"buckets,omitempty"`
+	Quantiles []float64      `json:"quantiles,omitempty"`
+	Histogram *HistogramData `json:"histogram,omitempty"`
+	Summary   *SummaryData   `json:"summary,omitempty"`
+}
+
+var (
+	ErrEmptyID      = errors.New("metric id is required")
+	ErrInvalidType  = errors.New("invalid metric type")
+	ErrMissingValue = errors.New("metric value is required")
+	ErrInvalidValue = errors.New("invalid metric value")
+)
+
+// ValidateValue отвергает NaN и бесконечности: их нельзя записать в JSON,
+// и одно такое значение ломает /metrics, сохранение в файл и потоки.
+func ValidateValue(value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("%w: %v is not finite", ErrInvalidValue, value)
+	}
+	return nil
+}
+
+// Validate проверяет, что метрику можно применить к хранилищу.
+func (m Metrics) Validate() error {
+	if m.ID == "" {
+		return ErrEmptyID
+	}
+	if err := m.Labels.Validate(); err != nil {
+		return fmt.Errorf("metric '%s': %w", m.ID, err)
+	}
+	switch m.MType {
+	case Gauge:
+		if m.Value == nil {
+			return fmt.Errorf("gauge '%s': %w", m.ID, ErrMissingValue)
+		}
+		if err := ValidateValue(*m.Value); err != nil {
+			return fmt.Errorf("gauge '%s': %w", m.ID, err)
+		}
+	case Counter:
+		if m.Delta == nil {
+			return fmt.Errorf("counter '%s': %w", m.ID, ErrMissingValue)
+		}
+	case Histogram, Summary:
+		if m.Value == nil {
+			return fmt.Errorf("%s '%s': %w", m.MType, m.ID, ErrMissingValue)
+		}
+		if err := ValidateValue(*m.Value); err != nil {
+			return fmt.Errorf("%s '%s': %w", m.MType, m.ID, err)
+		}
+		if m.MType == Histogram {
+			if err := ValidateBuckets(m.Buckets); err != nil {
+				return fmt.Errorf("histogram '%s': %w", m.ID, err)
+			}
+		} else if err := ValidateQuantiles(m.Quantiles); err != nil {
+			return fmt.Errorf("summary '%s': %w", m.ID, err)
+		}
+	default:
+		return fmt.Errorf("metric '%s' of type '%s': %w", m.ID, m.MType, ErrInvalidType)
+	}
+	return nil
 }
 
 const HTMLHead = `<!DOCTYPE html>
@@ -52,4 +124,45 @@ const HTMLHead = `<!DOCTYPE html>
     </style>
 </head>
 <body>
-    <h1>Metrics Dashboard</h1>`
\ No newline at end of file
+    <h1>Metrics Dashboard</h1>`
+
+// HTMLLiveScript обновляет значения gauge и counter на странице по /stream.
+// Ключ элемента — тип и ключ серии, как у SeriesID; для новой серии
+// страница перезагружается, но не чаще раза в 10 секунд.
+const HTMLLiveScript = `
+    <script>
+        (function () {
+            if (!window.EventSource) {
+                return;
+            }
+            var escape = function (s) {
+                return s.replace(/\\/g, "\\\\").replace(/,/g, "\\,").replace(/=/g, "\\=");
+            };
+            // имя экранируется как nameEscaper: без "="
+            var escapeName = function (s) {
+                return s.replace(/\\/g, "\\\\").replace(/,/g, "\\,");
+            };
+            var seriesID = function (m) {
+                var keys = Object.keys(m.labels || {}).sort();
+                return escapeName(m.id) + keys.map(function (k) {
+                    return "," + escape(k) + "=" + escape(m.labels[k]);
+                }).join("");
+            };
+            var reloadScheduled = false;
+            var update = function (e) {
+                var m = JSON.parse(e.data);
+                var el = document.querySelector('[data-metric="' + CSS.escape(m.type + ":" + seriesID(m)) + '"]');
+                if (!el) {
+                    if (!reloadScheduled) {
+                        reloadScheduled = true;
+                        setTimeout(function () { location.reload(); }, 10000);
+                    }
+                    return;
+                }
+                el.textContent = m.type === "gauge" ? m.value.toFixed(2) : String(m.delta);
+            };
+            var source = new EventSource("/stream");
+            source.addEventListener("gauge", update);
+            source.addEventListener("counter", update);
+        })();
+    </script>`